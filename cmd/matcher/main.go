@@ -0,0 +1,247 @@
+// Command matcher globs directories and tests paths against patterns.
+//
+// Usage:
+//
+//	matcher [glob] [-C dir] [-exclude pattern]... [-0 | -json] [-casefold] pattern...
+//	matcher test [-exclude pattern]... [-casefold] pattern... < paths
+//
+// The glob subcommand, the default, prints the paths within the directory
+// matched by any of the patterns and none of the exclude patterns.
+//
+// The test subcommand reads paths, one per line, from stdin and prints
+// whether each is Matched, NotMatched or should be followed (Follow), with the
+// patterns responsible. A directory matched along with everything below it is
+// MatchedAll. Directories should be given with a trailing slash.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/saracen/matcher"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+type config struct {
+	dir      string
+	excludes patterns
+	null     bool
+	json     bool
+	caseFold bool
+	includes []string
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cmd := "glob"
+	if len(args) > 0 && (args[0] == "glob" || args[0] == "test") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var cfg config
+
+	fs := flag.NewFlagSet("matcher "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Var(&cfg.excludes, "exclude", "exclude paths matching `pattern` (can be repeated)")
+	fs.BoolVar(&cfg.caseFold, "casefold", false, "match case-insensitively")
+	if cmd == "glob" {
+		fs.StringVar(&cfg.dir, "C", ".", "the `dir`ectory to glob")
+		fs.BoolVar(&cfg.null, "0", false, "separate paths with a null character")
+		fs.BoolVar(&cfg.json, "json", false, "print each path and its file info as JSON")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg.includes = fs.Args()
+	if len(cfg.includes) == 0 {
+		fmt.Fprintln(stderr, "matcher: at least one pattern is required")
+		fs.Usage()
+		return 2
+	}
+	if cfg.null && cfg.json {
+		fmt.Fprintln(stderr, "matcher: -0 and -json cannot be used together")
+		return 2
+	}
+
+	var err error
+	switch cmd {
+	case "glob":
+		err = glob(cfg, stdout)
+	case "test":
+		err = test(cfg, stdin, stdout)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "matcher: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func (cfg config) matchOptions() []matcher.MatchOption {
+	if cfg.caseFold {
+		return []matcher.MatchOption{matcher.WithCaseFold()}
+	}
+	return nil
+}
+
+func (cfg config) matchers(patterns []string) []matcher.Matcher {
+	matchers := make([]matcher.Matcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		matchers = append(matchers, matcher.New(pattern, cfg.matchOptions()...))
+	}
+	return matchers
+}
+
+func (cfg config) matcher() matcher.Matcher {
+	m := matcher.Multi(cfg.matchers(cfg.includes)...)
+	if len(cfg.excludes) > 0 {
+		m = matcher.Exclude(m, matcher.Multi(cfg.matchers(cfg.excludes)...))
+	}
+
+	return m
+}
+
+type fileInfo struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"modTime"`
+	IsDir   bool      `json:"isDir"`
+}
+
+func glob(cfg config, w io.Writer) error {
+	matches, err := matcher.Glob(context.Background(), cfg.dir, cfg.matcher())
+	if err != nil {
+		return err
+	}
+
+	pathnames := make([]string, 0, len(matches))
+	for pathname := range matches {
+		pathnames = append(pathnames, pathname)
+	}
+	sort.Strings(pathnames)
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	for _, pathname := range pathnames {
+		switch {
+		case cfg.json:
+			fi := matches[pathname]
+			err = enc.Encode(fileInfo{
+				Path:    pathname,
+				Size:    fi.Size(),
+				Mode:    fi.Mode().String(),
+				ModTime: fi.ModTime(),
+				IsDir:   fi.IsDir(),
+			})
+
+		case cfg.null:
+			_, err = fmt.Fprintf(bw, "%s\x00", pathname)
+
+		default:
+			_, err = fmt.Fprintln(bw, pathname)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+func test(cfg config, r io.Reader, w io.Writer) error {
+	m := cfg.matcher()
+	includes := cfg.matchers(cfg.includes)
+	excludes := cfg.matchers(cfg.excludes)
+
+	bw := bufio.NewWriter(w)
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		pathname := scanner.Text()
+		if pathname == "" {
+			continue
+		}
+
+		result, err := m.Match(pathname)
+		if err != nil {
+			return fmt.Errorf("%s: %w", pathname, err)
+		}
+
+		explanation, err := explain(pathname, result, cfg.includes, includes, cfg.excludes, excludes)
+		if err != nil {
+			return fmt.Errorf("%s: %w", pathname, err)
+		}
+
+		fmt.Fprintf(bw, "%s\t%s\t%s\n", result, pathname, explanation)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// explain returns which patterns were responsible for the result of matching
+// a path with the matcher used by glob.
+func explain(pathname string, result matcher.Result, includePatterns []string, includes []matcher.Matcher, excludePatterns []string, excludes []matcher.Matcher) (string, error) {
+	if result == matcher.NotMatched {
+		for i, m := range excludes {
+			excluded, err := m.Match(pathname)
+			if err != nil {
+				return "", err
+			}
+			if excluded.Matched() {
+				return fmt.Sprintf("excluded by %q", excludePatterns[i]), nil
+			}
+		}
+
+		return "not matched by any pattern", nil
+	}
+
+	var responsible []string
+	for i, m := range includes {
+		included, err := m.Match(pathname)
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case result == matcher.Follow && included == matcher.Follow:
+			responsible = append(responsible, fmt.Sprintf("%q", includePatterns[i]))
+
+		case result != matcher.Follow && included.Matched():
+			return fmt.Sprintf("matched by %q", includePatterns[i]), nil
+		}
+	}
+
+	return "descendants might be matched by " + strings.Join(responsible, ", "), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+
+	os.MkdirAll(filepath.Join(dir, "src", "vendor"), 0o777)
+	os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main"), 0o600)
+	os.WriteFile(filepath.Join(dir, "src", "vendor", "lib.go"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte{}, 0o600)
+
+	tests := map[string]struct {
+		args     []string
+		expected string
+	}{
+		"plain": {
+			args:     []string{"-C", dir, "-exclude", "src/vendor/**", "**/*.go", "*.md"},
+			expected: filepath.Join(dir, "README.md") + "\n" + filepath.Join(dir, "src", "main.go") + "\n",
+		},
+		"null": {
+			args:     []string{"glob", "-C", dir, "-0", "**/*.go"},
+			expected: filepath.Join(dir, "src", "main.go") + "\x00" + filepath.Join(dir, "src", "vendor", "lib.go") + "\x00",
+		},
+		"casefold": {
+			args:     []string{"-C", dir, "-casefold", "readme.MD"},
+			expected: filepath.Join(dir, "README.md") + "\n",
+		},
+	}
+
+	for tn, tc := range tests {
+		t.Run(tn, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tc.args, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("exit code was %d: %s", code, stderr.String())
+			}
+
+			if stdout.String() != tc.expected {
+				t.Errorf("output was %q expected %q", stdout.String(), tc.expected)
+			}
+		})
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-C", dir, "-json", "src/*.go"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code was %d: %s", code, stderr.String())
+	}
+
+	var fi fileInfo
+	if err := json.Unmarshal(stdout.Bytes(), &fi); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Path != filepath.Join(dir, "src", "main.go") || fi.Size != 12 || fi.IsDir {
+		t.Errorf("unexpected file info %+v", fi)
+	}
+}
+
+func TestTest(t *testing.T) {
+	stdin := strings.NewReader("src/main.go\nsrc/\nsrc/vendor/lib.go\nREADME.md\n")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"test", "-exclude", "src/vendor/**", "src/**/*.go"}, stdin, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code was %d: %s", code, stderr.String())
+	}
+
+	expected := "Matched\tsrc/main.go\tmatched by \"src/**/*.go\"\n" +
+		"Follow\tsrc/\tdescendants might be matched by \"src/**/*.go\"\n" +
+		"NotMatched\tsrc/vendor/lib.go\texcluded by \"src/vendor/**\"\n" +
+		"NotMatched\tREADME.md\tnot matched by any pattern\n"
+
+	if stdout.String() != expected {
+		t.Errorf("output was %q expected %q", stdout.String(), expected)
+	}
+
+	// a directory below which paths can be excluded isn't MatchedAll
+	stdin = strings.NewReader("vendor/\nvendor/x.tmp\n")
+
+	stdout.Reset()
+	if code := run([]string{"test", "-exclude", "**/*.tmp", "vendor/**"}, stdin, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code was %d: %s", code, stderr.String())
+	}
+
+	expected = "Matched\tvendor/\tmatched by \"vendor/**\"\n" +
+		"NotMatched\tvendor/x.tmp\texcluded by \"**/*.tmp\"\n"
+
+	if stdout.String() != expected {
+		t.Errorf("output was %q expected %q", stdout.String(), expected)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"test"}, {"-0", "-json", "*"}, {"-unknown"}} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, nil, &stdout, &stderr); code != 2 {
+			t.Errorf("args %q exit code was %d expected 2", args, code)
+		}
+	}
+}
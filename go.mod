@@ -1,7 +1,5 @@
 module github.com/saracen/matcher
 
-go 1.17
+go 1.18
 
-require github.com/saracen/walker v0.1.3
-
-require golang.org/x/sync v0.0.0-20220601150217-0de741cfad7f // indirect
+require golang.org/x/sync v0.0.0-20220601150217-0de741cfad7f
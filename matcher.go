@@ -5,10 +5,12 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
-
-	"github.com/saracen/walker"
+	"sync/atomic"
+	"time"
+	"unsafe"
 )
 
 type Result int
@@ -22,34 +24,143 @@ const (
 	NotMatched Result = iota
 	Matched
 	Follow
+
+	// MatchedAll is returned for a directory that is matched along with
+	// every path below it, so the paths below needn't be matched. Use
+	// Result.Matched to check for either kind of match.
+	MatchedAll
 )
 
+func (r Result) String() string {
+	switch r {
+	case NotMatched:
+		return "NotMatched"
+	case Matched:
+		return "Matched"
+	case Follow:
+		return "Follow"
+	case MatchedAll:
+		return "MatchedAll"
+	}
+	return "Result(" + strconv.Itoa(int(r)) + ")"
+}
+
+// Matched returns whether the result is Matched or MatchedAll. Directories
+// can be MatchedAll, so this should be used in place of comparing with
+// Matched.
+func (r Result) Matched() bool {
+	return r == Matched || r == MatchedAll
+}
+
 // Matcher is an interface used for matching a path against a pattern.
 type Matcher interface {
 	Match(pathname string) (Result, error)
 }
 
+// BytesMatcher is implemented by Matchers that can match a path held in a
+// byte slice without first copying it to a string. Matchers returned by New,
+// Multi and Exclude implement BytesMatcher.
+type BytesMatcher interface {
+	MatchBytes(pathname []byte) (Result, error)
+}
+
+// DescendantMatcher is implemented by Matchers that can determine precisely
+// whether any path below a directory can be matched, allowing callers walking
+// paths themselves to prune optimally. Matchers returned by New, Multi and
+// Exclude implement DescendantMatcher.
+type DescendantMatcher interface {
+	// CanMatchBelow returns whether any path below the directory provided
+	// can be matched. The directory is relative, with or without a trailing
+	// '/', and is the root when empty.
+	CanMatchBelow(dir string) bool
+}
+
+// canMatchBelow returns whether any path below a directory can be matched,
+// using CanMatchBelow if the matcher supports it, and otherwise whether the
+// matcher returns Matched or Follow for the directory.
+func canMatchBelow(m Matcher, dir string) bool {
+	if dm, ok := m.(DescendantMatcher); ok {
+		return dm.CanMatchBelow(dir)
+	}
+
+	if dir != "" && !strings.HasSuffix(dir, separator) {
+		dir += separator
+	}
+
+	result, err := m.Match(dir)
+	return err == nil && result != NotMatched
+}
+
+// matchBytes matches a path held in a byte slice, using MatchBytes if the
+// matcher supports it.
+func matchBytes(m Matcher, pathname []byte) (Result, error) {
+	if bm, ok := m.(BytesMatcher); ok {
+		return bm.MatchBytes(pathname)
+	}
+
+	return m.Match(string(pathname))
+}
+
+// bytesToString returns a string sharing the byte slice's memory. The string
+// must not be retained and the byte slice not modified whilst it is in use.
+func bytesToString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
 type matcher struct {
+	source  string
 	pattern []string
+	matchFn func(pattern, name string) (matched bool, err error)
 	options matchOptions
+	err     error
+
+	// implicit is whether a leading globstar was added by the options
+	implicit bool
 }
 
 // New returns a new Matcher.
 //
 // The Matcher returned uses the same rules as Match, but returns a result of
-// either NotMatched, Matched or Follow.
+// either NotMatched, Matched, MatchedAll or Follow.
 //
 // Follow hints to the caller that whilst the pattern wasn't matched, path
 // traversal might yield matches. This allows for more efficient globbing,
-// preventing path traversal where a match is impossible.
+// preventing path traversal where a match is impossible. With
+// WithStrictFollow, Follow is only returned when traversal will yield a match
+// for some path below.
+//
+// MatchedAll is returned for a directory when the pattern ends with a globstar
+// that matches every path below it, such as 'vendor/' for 'vendor/**'.
+//
+// Unless WithMatchFunc is used, the pattern is validated up front, and if
+// malformed, every call to Match returns ErrBadPattern.
+//
+// The Matcher returned also implements DescendantMatcher, Stepper and
+// CaptureMatcher.
 func New(pattern string, opts ...MatchOption) Matcher {
-	matcher := matcher{pattern: strings.Split(pattern, separator)}
+	matcher := matcher{source: pattern}
 	for _, o := range opts {
 		o(&matcher.options)
 	}
-
-	if matcher.options.MatchFn == nil {
-		matcher.options.MatchFn = path.Match
+	normalized := matcher.options.normalize(pattern)
+	anchored := matcher.options.anchor(normalized)
+	matcher.pattern = strings.Split(anchored, separator)
+
+	// anchoring either removes a leading separator or adds a globstar
+	matcher.implicit = len(anchored) > len(normalized)
+
+	matcher.matchFn = matcher.options.MatchFn
+	if matcher.matchFn == nil {
+		matcher.matchFn = path.Match
+
+		// like path.Match, a malformed pattern is an error regardless of
+		// whether the malformed part is reached when matching
+		for _, segment := range matcher.pattern {
+			if _, err := path.Match(segment, ""); err != nil {
+				matcher.err = err
+				break
+			}
+		}
 	}
 
 	return matcher
@@ -64,53 +175,359 @@ func New(pattern string, opts ...MatchOption) Matcher {
 func Match(pattern, pathname string, opts ...MatchOption) (bool, error) {
 	result, err := New(pattern, opts...).Match(pathname)
 
-	return result == Matched, err
+	return result.Matched(), err
 }
 
 func (p matcher) Match(pathname string) (Result, error) {
-	return match(p.pattern, strings.Split(pathname, separator), p.options.MatchFn)
+	if p.err != nil {
+		return NotMatched, p.err
+	}
+
+	pathname = p.options.normalize(pathname)
+
+	return p.match(pathname)
 }
 
-func match(pattern, parts []string, matchFn func(pattern, name string) (matched bool, err error)) (Result, error) {
-	for {
-		switch {
-		case len(pattern) == 0 && len(parts) == 0:
-			return Matched, nil
+// MatchBytes is the same as Match, but for a path held in a byte slice.
+func (p matcher) MatchBytes(pathname []byte) (Result, error) {
+	// the built-in match function doesn't retain the path, so it can be
+	// matched without a copy
+	if p.options.MatchFn == nil {
+		return p.Match(bytesToString(pathname))
+	}
 
-		case len(parts) == 0:
-			return Follow, nil
+	return p.Match(string(pathname))
+}
+
+// segments iterates over the '/' separated segments of a path, with the same
+// results as strings.Split, but without allocating.
+type segments struct {
+	path string
+	done bool
+}
+
+// first returns the first segment.
+func (s segments) first() string {
+	if i := strings.IndexByte(s.path, '/'); i >= 0 {
+		return s.path[:i]
+	}
+	return s.path
+}
+
+// next returns the segments following the first.
+func (s segments) next() segments {
+	if i := strings.IndexByte(s.path, '/'); i >= 0 {
+		return segments{path: s.path[i+1:]}
+	}
+	return segments{done: true}
+}
+
+// last returns whether there is only one segment remaining.
+func (s segments) last() bool {
+	return strings.IndexByte(s.path, '/') < 0
+}
+
+// positions is a set of positions within a pattern.
+type positions []uint64
+
+func newPositions(pattern []string, buf []uint64) positions {
+	// there are len(pattern)+1 positions, the last being the accepting one
+	words := len(pattern)/64 + 1
+	if words <= len(buf) {
+		return buf[:words]
+	}
+	return make(positions, words)
+}
+
+func (s positions) has(i int) bool {
+	return s[i/64]&(1<<(uint(i)%64)) != 0
+}
+
+func (s positions) set(i int) {
+	s[i/64] |= 1 << (uint(i) % 64)
+}
+
+func (s positions) reset() {
+	for i := range s {
+		s[i] = 0
+	}
+}
+
+func (s positions) equal(o positions) bool {
+	for i := range s {
+		if s[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s positions) empty() bool {
+	for _, w := range s {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// match simulates the pattern as a nondeterministic finite automaton, where
+// each position within the pattern is a state and each path segment an input.
+// All positions are advanced together, so matching takes at most
+// O(segments * positions) steps, regardless of the number of globstars.
+func (p matcher) match(pathname string) (Result, error) {
+	var buf [2][4]uint64
+
+	cur := newPositions(p.pattern, buf[0][:])
+	next := newPositions(p.pattern, buf[1][:])
+
+	p.enter(cur, 0)
+
+	var follow, all, dir bool
+	for parts := (segments{path: pathname}); !parts.done; parts = parts.next() {
+		part := parts.first()
+
+		// a directory, indicated by a trailing separator, should be followed
+		// if the pattern wasn't exhausted by the path leading up to it
+		if part == "" && parts.last() {
+			dir = true
+			follow = p.follow(cur)
+			all = p.all(cur)
+		}
+
+		next.reset()
+		if err := p.step(cur, next, part); err != nil {
+			return NotMatched, err
+		}
+		cur, next = next, cur
+
+		if cur.empty() {
+			break
+		}
+	}
+
+	switch {
+	case cur.has(len(p.pattern)) && all:
+		return MatchedAll, nil
+
+	case cur.has(len(p.pattern)):
+		return Matched, nil
+
+	case follow:
+		return Follow, nil
+
+	// in strict mode, a directory's trailing separator isn't part of the
+	// paths below it
+	case (!dir || !p.options.Strict) && p.follow(cur):
+		return Follow, nil
+	}
+
+	return NotMatched, nil
+}
+
+// CanMatchBelow returns whether any path below the directory provided can be
+// matched. A malformed pattern can match nothing.
+func (p matcher) CanMatchBelow(dir string) bool {
+	if p.err != nil {
+		return false
+	}
 
-		case len(pattern) == 0:
-			return NotMatched, nil
+	var buf [2][4]uint64
 
-		case pattern[0] == globstar && len(pattern) == 1:
-			return Matched, nil
+	cur := newPositions(p.pattern, buf[0][:])
+	next := newPositions(p.pattern, buf[1][:])
 
-		case pattern[0] == globstar:
-			for i := range parts {
-				result, err := match(pattern[1:], parts[i:], matchFn)
-				if result == Matched || err != nil {
-					return result, err
-				}
+	p.enter(cur, 0)
+
+	dir = strings.TrimSuffix(p.options.normalize(dir), separator)
+	if dir != "" {
+		for parts := (segments{path: dir}); !parts.done; parts = parts.next() {
+			next.reset()
+			if err := p.step(cur, next, parts.first()); err != nil {
+				return false
+			}
+			cur, next = next, cur
+
+			if cur.empty() {
+				return false
 			}
-			return Follow, nil
 		}
+	}
+
+	return p.below(cur)
+}
+
+// all returns whether every path below a directory leading to the set of
+// positions is matched, because a trailing globstar is reached. With hidden
+// paths excluded, there can be paths below that globstar doesn't match.
+func (p matcher) all(s positions) bool {
+	last := len(p.pattern) - 1
+
+	return p.pattern[last] == globstar && s.has(last) && !p.options.NoDotfiles
+}
+
+// follow returns whether a path leading to the set of positions should be
+// followed.
+func (p matcher) follow(s positions) bool {
+	if p.options.Strict {
+		return p.below(s)
+	}
+	return p.prefix(s)
+}
+
+// below returns whether the accepting position can be reached from the set by
+// one or more names, optionally followed by a directory's trailing separator.
+//
+// Any pattern segment, other than an empty one, is assumed to match some name,
+// so positions are advanced over every segment until no more are added.
+func (p matcher) below(s positions) bool {
+	var buf [2][4]uint64
+
+	reached := newPositions(p.pattern, buf[0][:])
+	next := newPositions(p.pattern, buf[1][:])
+
+	p.stepAny(s, reached)
+	for {
+		copy(next, reached)
+		p.stepAny(reached, next)
+
+		if reached.equal(next) {
+			break
+		}
+		reached, next = next, reached
+	}
 
-		matched, err := matchFn(pattern[0], parts[0])
+	last := len(p.pattern) - 1
+
+	return reached.has(last+1) || (reached.has(last) && p.pattern[last] == "")
+}
+
+// stepAny advances each position in cur over any name, adding the resulting
+// positions to next.
+func (p matcher) stepAny(cur, next positions) {
+	last := len(p.pattern) - 1
+
+	for i := 0; i <= last; i++ {
 		switch {
-		case err != nil:
-			return NotMatched, err
+		case !cur.has(i):
+
+		case p.pattern[i] == globstar:
+			p.enter(next, i)
+			if i == last {
+				next.set(i + 1)
+			}
+
+		case p.pattern[i] != "":
+			p.enter(next, i+1)
+		}
+	}
+}
+
+// enter adds a position to the set, along with the positions following any
+// globstars that can match zero segments.
+func (p matcher) enter(s positions, i int) {
+	for {
+		s.set(i)
+
+		// a trailing globstar must match at least one segment
+		if i >= len(p.pattern)-1 || p.pattern[i] != globstar {
+			return
+		}
+		i++
+	}
+}
+
+// prefix returns whether the set contains any position other than the
+// accepting one.
+func (p matcher) prefix(s positions) bool {
+	for i := 0; i < len(p.pattern); i++ {
+		if s.has(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// step advances each position in cur that matches the path segment, adding
+// the resulting positions to next.
+func (p matcher) step(cur, next positions, part string) error {
+	last := len(p.pattern) - 1
+
+	for i := 0; i <= last; i++ {
+		if !cur.has(i) {
+			continue
+		}
 
-		case !matched && len(parts) == 1 && parts[0] == "":
-			return Follow, nil
+		if p.pattern[i] == globstar {
+			if p.hidden(part) {
+				continue
+			}
 
-		case !matched:
-			return NotMatched, nil
+			p.enter(next, i)
+			if i == last {
+				next.set(i + 1)
+			}
+			continue
 		}
 
-		pattern = pattern[1:]
-		parts = parts[1:]
+		matched, err := p.matchFn(p.pattern[i], part)
+		if err != nil {
+			return err
+		}
+
+		if matched && (!p.hidden(part) || explicitlyHidden(p.pattern[i])) {
+			p.enter(next, i+1)
+		}
+	}
+
+	return nil
+}
+
+// hidden returns whether a path segment is hidden and wildcards and globstar
+// are prevented from matching it.
+func (p matcher) hidden(part string) bool {
+	return p.options.NoDotfiles && strings.HasPrefix(part, ".")
+}
+
+// dotfileHider is implemented by the Matchers in this package, which can
+// match as if WithDotfiles(false) was used.
+type dotfileHider interface {
+	withoutDotfiles() Matcher
+}
+
+func (p matcher) withoutDotfiles() Matcher {
+	p.options.NoDotfiles = true
+	return p
+}
+
+// withoutDotfiles returns a Matcher matching as if WithDotfiles(false) was
+// used, or that doesn't match hidden paths at all, if it can't.
+func withoutDotfiles(m Matcher) Matcher {
+	if h, ok := m.(dotfileHider); ok {
+		return h.withoutDotfiles()
 	}
+
+	return noHiddenMatcher{m}
+}
+
+// noHiddenMatcher returns NotMatched for any path with a segment beginning
+// with a '.'.
+type noHiddenMatcher struct {
+	Matcher
+}
+
+func (p noHiddenMatcher) Match(pathname string) (Result, error) {
+	if strings.HasPrefix(pathname, ".") || strings.Contains(pathname, separator+".") {
+		return NotMatched, nil
+	}
+
+	return p.Matcher.Match(pathname)
+}
+
+// explicitlyHidden returns whether a pattern segment can only match hidden
+// path segments.
+func explicitlyHidden(pattern string) bool {
+	return strings.HasPrefix(pattern, ".") || strings.HasPrefix(pattern, `\.`)
 }
 
 // Glob returns the pathnames and their associated os.FileInfos of all files
@@ -119,11 +536,24 @@ func match(pattern, parts []string, matchFn func(pattern, name string) (matched
 // Patterns are matched against the path relative to the directory provided
 // and path seperators are converted to '/'. Be aware that the matching
 // performed by this library's Matchers are case sensitive (even on
-// case-insensitive filesystems). Use WithPathTransformer(strings.ToLower)
-// and NewMatcher(strings.ToLower(pattern)) to perform case-insensitive
-// matching.
+// case-insensitive filesystems). Use New(pattern, WithCaseFold()) to perform
+// case-insensitive matching.
+//
+// Glob ignores any permission and I/O errors. The concurrency and rate of I/O
+// can be controlled with WithWorkers, WithMaxConcurrentReads and
+// WithRateLimiter, which is useful for shared or network filesystems.
+// WithStats and WithProgress report on what the Glob is doing.
 //
-// Glob ignores any permission and I/O errors.
+// Directories the Matcher returns NotMatched for aren't traversed, nor are
+// those Matched that nothing below can match, as reported by
+// DescendantMatcher. Paths below a directory that is MatchedAll are matched
+// without the Matcher being consulted. If the Matcher is a Stepper, entries
+// are matched by stepping the State of their directory, rather than matching
+// their whole path.
+//
+// By default, every file and directory encountered is stat'd. With
+// WithLazyFileInfo, matching is performed using only the name and type of each
+// directory entry, and only the entries matched are stat'd.
 func Glob(ctx context.Context, dir string, matcher Matcher, opts ...GlobOption) (map[string]os.FileInfo, error) {
 	var options globOptions
 	for _, o := range opts {
@@ -133,22 +563,38 @@ func Glob(ctx context.Context, dir string, matcher Matcher, opts ...GlobOption)
 		}
 	}
 
+	if options.NoHiddenFiles {
+		matcher = withoutDotfiles(matcher)
+	}
+
 	matches := make(map[string]os.FileInfo)
 
 	var m sync.Mutex
 
-	ignoreErrors := walker.WithErrorCallback(func(pathname string, err error) error {
-		return nil
-	})
+	descendants, _ := matcher.(DescendantMatcher)
+
+	// the State of each directory is passed to its entries, when the matcher
+	// is a Stepper and sees the real path
+	stepper, _ := matcher.(Stepper)
+	if options.PathTransform != nil {
+		stepper = nil
+	}
 
-	walkFn := func(pathname string, fi os.FileInfo) error {
-		rel := strings.TrimPrefix(pathname, dir)
-		rel = strings.TrimPrefix(filepath.ToSlash(rel), "/")
-		if rel == "" {
-			return nil
+	counters := globCounters{start: time.Now()}
+	defer counters.report(&options)()
+
+	walkFn := func(pathname string, entry os.DirEntry, parent walkState) (walkState, error) {
+		// the walker joins each entry's name to its parent with a separator,
+		// so everything after the directory and separator is relative
+		if len(pathname) <= len(dir) {
+			if stepper != nil {
+				return walkState{state: stepper.Root()}, nil
+			}
+			return walkState{}, nil
 		}
+		rel := filepath.ToSlash(pathname[len(dir)+1:])
 
-		if fi.IsDir() {
+		if entry.IsDir() {
 			rel += "/"
 		}
 
@@ -156,25 +602,63 @@ func Glob(ctx context.Context, dir string, matcher Matcher, opts ...GlobOption)
 			rel = options.PathTransform(rel)
 		}
 
-		result, err := matcher.Match(rel)
+		// everything below a directory that was MatchedAll is matched
+		// without consulting the matcher
+		var (
+			result Result
+			ws     walkState
+			err    error
+		)
+		switch {
+		case parent.all:
+			result = MatchedAll
+
+		case stepper != nil:
+			ws.state, result, err = advance(stepper, parent.state, entry.Name(), entry.IsDir(), false)
+
+		default:
+			result, err = matcher.Match(rel)
+		}
 		if err != nil {
-			return err
+			return walkState{}, err
 		}
 
-		if result == Matched {
-			m.Lock()
-			defer m.Unlock()
+		if result.Matched() {
+			fi, err := entry.Info()
+			switch {
+			case ignorable(err):
+			case err != nil:
+				return walkState{}, err
+			default:
+				atomic.AddInt64(&counters.matched, 1)
+
+				m.Lock()
+				matches[pathname] = fi
+				m.Unlock()
+			}
+		}
 
-			matches[pathname] = fi
+		if !entry.IsDir() {
+			return walkState{}, nil
 		}
 
-		follow := result == Matched || result == Follow
-		if fi.IsDir() && !follow {
-			return filepath.SkipDir
+		switch {
+		// the matcher is only trusted to describe paths below a directory
+		// when it's seeing the real path
+		case result == MatchedAll && options.PathTransform == nil:
+			ws.all = true
+
+		case result == Matched && options.PathTransform == nil && descendants != nil && !descendants.CanMatchBelow(rel):
+			atomic.AddInt64(&counters.pruned, 1)
+			return walkState{}, filepath.SkipDir
+
+		case result == NotMatched:
+			atomic.AddInt64(&counters.pruned, 1)
+			return walkState{}, filepath.SkipDir
 		}
 
-		return nil
+		return ws, nil
 	}
 
-	return matches, walker.WalkWithContext(ctx, dir, walkFn, ignoreErrors)
+	return matches, walk(ctx, dir, &options, &counters, walkFn)
 }
@@ -0,0 +1,116 @@
+package matcher
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"path"
+	"strings"
+)
+
+// MatchTar reads a tar archive, which can be gzip or bzip2 compressed, and
+// returns the headers of all entries matching with the Matcher provided.
+//
+// The archive is streamed, so it is never extracted or held in memory.
+// Entry names are normalized the same way paths are by Glob: they're made
+// relative and directory entries are given a trailing '/'.
+func MatchTar(r io.Reader, matcher Matcher) ([]*tar.Header, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*tar.Header
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return matches, nil
+		}
+		if err != nil {
+			return matches, err
+		}
+
+		matched, err := matchEntry(matcher, hdr.Name, hdr.Typeflag == tar.TypeDir)
+		if err != nil {
+			return matches, err
+		}
+
+		if matched {
+			matches = append(matches, hdr)
+		}
+	}
+}
+
+// MatchZip returns the files within a zip archive matching with the Matcher
+// provided.
+//
+// Entry names are normalized the same way paths are by Glob: they're made
+// relative and directory entries are given a trailing '/'.
+func MatchZip(r *zip.Reader, matcher Matcher) ([]*zip.File, error) {
+	var matches []*zip.File
+
+	for _, f := range r.File {
+		matched, err := matchEntry(matcher, f.Name, f.FileInfo().IsDir())
+		if err != nil {
+			return matches, err
+		}
+
+		if matched {
+			matches = append(matches, f)
+		}
+	}
+
+	return matches, nil
+}
+
+// matchEntry normalizes an archive entry's name and matches it.
+func matchEntry(matcher Matcher, name string, isDir bool) (bool, error) {
+	isDir = isDir || strings.HasSuffix(name, separator)
+
+	// cleaning the name as if it were absolute removes leading slashes and
+	// any ".." elements that would escape the root
+	rel := path.Clean(separator + name)[1:]
+	if rel == "" {
+		return false, nil
+	}
+
+	if isDir {
+		rel += separator
+	}
+
+	result, err := matcher.Match(rel)
+
+	return result.Matched(), err
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+// decompress detects whether a stream is gzip or bzip2 compressed and returns
+// a reader of the decompressed data.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return bzip2.NewReader(br), nil
+	}
+
+	return br, nil
+}
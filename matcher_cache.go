@@ -0,0 +1,156 @@
+package matcher
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"time"
+)
+
+// GlobCache caches directory listings between Globs. Use WithCache to have
+// Glob use a cache.
+//
+// A directory is only read again if its modification time has changed since
+// it was cached. Creating, removing and renaming files updates the
+// modification time of the directory they're in, but modifying a file's
+// content does not, so only the names and types of entries are cached, and
+// the os.FileInfos returned by Glob are always current.
+//
+// The listings of the directories least recently read are evicted once the
+// cache is full.
+//
+// A GlobCache is safe for concurrent use.
+type GlobCache struct {
+	mu    sync.Mutex
+	size  int
+	dirs  map[string]*list.Element
+	order *list.List
+}
+
+// racyWindow is how long after a directory's modification time it has to be
+// read for its listing to be trusted. Filesystem timestamps are often coarser
+// than the clock, so a directory modified shortly after being read can end up
+// with a modification time before it.
+const racyWindow = 2 * time.Second
+
+// defaultCacheSize is the number of directory listings cached when no size is
+// provided.
+const defaultCacheSize = 10000
+
+type cachedDir struct {
+	dirname string
+	modTime time.Time
+	read    time.Time
+	entries []os.DirEntry
+}
+
+// NewGlobCache returns a new, empty, GlobCache holding the listings of up to
+// size directories. If size isn't positive, up to 10000 are held.
+func NewGlobCache(size int) *GlobCache {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+
+	return &GlobCache{
+		size:  size,
+		dirs:  make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Reset removes all cached directory listings.
+func (c *GlobCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dirs = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// Len returns the number of directory listings cached.
+func (c *GlobCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.dirs)
+}
+
+// list returns the entries of a directory, from the cache if the directory is
+// unchanged.
+func (c *GlobCache) list(w *walker, dirname string) ([]os.DirEntry, error) {
+	if err := w.wait(); err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(dirname)
+	if err != nil {
+		c.forget(dirname)
+		return nil, err
+	}
+
+	if entries, ok := c.lookup(dirname, fi.ModTime()); ok {
+		return entries, nil
+	}
+
+	read := time.Now()
+
+	entries, err := w.list(dirname)
+	if err != nil {
+		c.forget(dirname)
+		return nil, err
+	}
+
+	c.store(&cachedDir{dirname: dirname, modTime: fi.ModTime(), read: read, entries: entries})
+
+	return entries, nil
+}
+
+// lookup returns the cached entries of a directory, if its modification time
+// is unchanged.
+func (c *GlobCache) lookup(dirname string, modTime time.Time) ([]os.DirEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.dirs[dirname]
+	if !ok {
+		return nil, false
+	}
+
+	cached := e.Value.(*cachedDir)
+	if !cached.modTime.Equal(modTime) || !cached.modTime.Add(racyWindow).Before(cached.read) {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+
+	return cached.entries, true
+}
+
+// store caches a directory's listing, evicting the least recently used if the
+// cache is full.
+func (c *GlobCache) store(dir *cachedDir) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.dirs[dir.dirname]; ok {
+		e.Value = dir
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.dirs[dir.dirname] = c.order.PushFront(dir)
+	for len(c.dirs) > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.dirs, oldest.Value.(*cachedDir).dirname)
+	}
+}
+
+func (c *GlobCache) forget(dirname string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.dirs[dirname]; ok {
+		c.order.Remove(e)
+		delete(c.dirs, dirname)
+	}
+}
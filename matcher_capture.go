@@ -0,0 +1,224 @@
+package matcher
+
+import (
+	"errors"
+	"path"
+	"unicode/utf8"
+)
+
+// CaptureMatcher is implemented by Matchers that can return what each
+// wildcard of a pattern matched. Matchers returned by New implement
+// CaptureMatcher.
+type CaptureMatcher interface {
+	MatchCapture(pathname string) (Result, []string, error)
+}
+
+// MatchCapture is the same as Match, but for a path that is Matched or
+// MatchedAll, also returns what each '*', '?', character class and '**' of
+// the pattern matched, in the order they appear.
+//
+// A '*' matches as few characters as possible and a '**' as few path
+// segments as possible, with a '**' capturing the segments it matched joined
+// by '/'. For example, 'services/*/deploy/**/*.yaml' captures 'api', 'eu/prod'
+// and 'app' from 'services/api/deploy/eu/prod/app.yaml'. A directory's
+// trailing '/' is never captured.
+//
+// Captures are of the path after Windows path normalization, but retain their
+// case when matching case-insensitively. Captures use the path.Match syntax,
+// so aren't supported by Matchers using WithMatchFunc.
+func (p matcher) MatchCapture(pathname string) (Result, []string, error) {
+	if p.options.MatchFn != nil {
+		return NotMatched, nil, errors.New("matcher: captures are not supported with a custom match function")
+	}
+
+	result, err := p.Match(pathname)
+	if err != nil || !result.Matched() {
+		return result, nil, err
+	}
+
+	// captures are sliced from the path before case folding, so long as
+	// folding hasn't changed the offsets
+	options := p.options
+	options.CaseFold = false
+
+	original := options.normalize(pathname)
+	folded := p.options.normalize(pathname)
+	if len(original) != len(folded) {
+		original = folded
+	}
+
+	c := capturer{matcher: p, path: folded}
+	for parts := (segments{path: folded}); !parts.done; parts = parts.next() {
+		start := 0
+		if len(c.parts) > 0 {
+			start = c.parts[len(c.parts)-1][1] + 1
+		}
+		c.parts = append(c.parts, [2]int{start, start + len(parts.first())})
+	}
+
+	if !c.segments(0, 0) {
+		return result, nil, nil
+	}
+
+	// the globstar added by anchoring options isn't part of the pattern
+	if p.implicit {
+		c.captures = c.captures[1:]
+	}
+
+	captures := make([]string, len(c.captures))
+	for i, capture := range c.captures {
+		captures[i] = original[capture[0]:capture[1]]
+	}
+
+	return result, captures, nil
+}
+
+// capturer finds what each wildcard of a pattern matched by backtracking,
+// remembering where matching has already failed so that it takes polynomial
+// time. The parts and captures are the start and end offsets within the path.
+type capturer struct {
+	matcher  matcher
+	path     string
+	parts    [][2]int
+	captures [][2]int
+	failed   map[[2]int]bool
+}
+
+// segments matches the pattern from segment i against the path from part j.
+func (c *capturer) segments(i, j int) bool {
+	pattern, parts := c.matcher.pattern, c.parts
+
+	if i == len(pattern) {
+		return j == len(parts)
+	}
+	if c.failed[[2]int{i, j}] {
+		return false
+	}
+
+	n := len(c.captures)
+
+	if pattern[i] == globstar {
+		// a trailing globstar must match at least one segment
+		min := 0
+		if i == len(pattern)-1 {
+			min = 1
+		}
+
+		for k := j + min; k <= len(parts); k++ {
+			if k > j && c.matcher.hidden(c.part(k-1)) {
+				break
+			}
+
+			capture := [2]int{parts[j][0], parts[j][0]}
+			if k > j {
+				end := k - 1
+				if end > j && end == len(parts)-1 && c.part(end) == "" {
+					end--
+				}
+				capture[1] = parts[end][1]
+			}
+
+			c.captures = append(c.captures[:n], capture)
+			if c.segments(i+1, k) {
+				return true
+			}
+		}
+	} else if j < len(parts) {
+		part := c.part(j)
+		if !c.matcher.hidden(part) || explicitlyHidden(pattern[i]) {
+			if c.segment(pattern[i], 0, parts[j][0], parts[j][1], map[[2]int]bool{}) && c.segments(i+1, j+1) {
+				return true
+			}
+		}
+	}
+
+	c.captures = c.captures[:n]
+	if c.failed == nil {
+		c.failed = make(map[[2]int]bool)
+	}
+	c.failed[[2]int{i, j}] = true
+
+	return false
+}
+
+func (c *capturer) part(j int) string {
+	return c.path[c.parts[j][0]:c.parts[j][1]]
+}
+
+// segment matches a pattern segment from offset pi against the path from
+// offset ni to end, capturing what each wildcard matched.
+func (c *capturer) segment(pattern string, pi, ni, end int, failed map[[2]int]bool) bool {
+	if pi == len(pattern) {
+		return ni == end
+	}
+	if failed[[2]int{pi, ni}] {
+		return false
+	}
+
+	n := len(c.captures)
+
+	switch pattern[pi] {
+	case '*':
+		for k := ni; k <= end; k++ {
+			c.captures = append(c.captures[:n], [2]int{ni, k})
+			if c.segment(pattern, pi+1, k, end, failed) {
+				return true
+			}
+		}
+
+	case '?', '[':
+		if ni == end {
+			break
+		}
+
+		term := pattern[pi : pi+1]
+		if pattern[pi] == '[' {
+			term = pattern[pi : pi+classLen(pattern[pi:])]
+		}
+
+		_, w := utf8.DecodeRuneInString(c.path[ni:end])
+		if matched, _ := path.Match(term, c.path[ni:ni+w]); !matched {
+			break
+		}
+
+		c.captures = append(c.captures[:n], [2]int{ni, ni + w})
+		if c.segment(pattern, pi+len(term), ni+w, end, failed) {
+			return true
+		}
+
+	default:
+		next := pi + 1
+		if pattern[pi] == '\\' && next < len(pattern) {
+			next++
+		}
+
+		if ni < end && c.path[ni] == pattern[next-1] && c.segment(pattern, next, ni+1, end, failed) {
+			return true
+		}
+	}
+
+	c.captures = c.captures[:n]
+	failed[[2]int{pi, ni}] = true
+
+	return false
+}
+
+// classLen returns the length of the character class at the start of a
+// valid pattern.
+func classLen(pattern string) int {
+	i := 1
+	if i < len(pattern) && pattern[i] == '^' {
+		i++
+	}
+
+	for ; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\':
+			i++
+		case pattern[i] == ']':
+			return i + 1
+		}
+	}
+
+	return len(pattern)
+}
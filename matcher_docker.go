@@ -0,0 +1,311 @@
+package matcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DockerIgnore holds the patterns of a .dockerignore file. As a Matcher, it
+// matches the paths included in a build context.
+type DockerIgnore struct {
+	patterns []dockerPattern
+}
+
+// dockerMatchType is how a .dockerignore pattern is matched, as a pattern
+// with a leading or trailing '**' and no other wildcards is matched as a
+// suffix or prefix of the path.
+type dockerMatchType int
+
+const (
+	dockerExact dockerMatchType = iota
+	dockerPrefix
+	dockerSuffix
+	dockerRegexp
+)
+
+type dockerPattern struct {
+	pattern   string
+	exclusion bool
+	matchType dockerMatchType
+	regexp    *regexp.Regexp
+}
+
+// ParseDockerIgnore reads a .dockerignore file. Lines beginning with '#' are
+// comments, and the remaining lines are trimmed of whitespace and have their
+// paths cleaned, with a leading '/' ignored.
+func ParseDockerIgnore(r io.Reader) (*DockerIgnore, error) {
+	var patterns []string
+
+	scanner := bufio.NewScanner(r)
+	for first := true; scanner.Scan(); first = false {
+		line := scanner.Bytes()
+		if first {
+			line = bytes.TrimPrefix(line, []byte{0xEF, 0xBB, 0xBF})
+		}
+
+		pattern := string(line)
+		if strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		exclusion := pattern[0] == '!'
+		if exclusion {
+			pattern = strings.TrimSpace(pattern[1:])
+		}
+		if pattern != "" {
+			pattern = filepath.ToSlash(filepath.Clean(pattern))
+			if len(pattern) > 1 && pattern[0] == '/' {
+				pattern = pattern[1:]
+			}
+		}
+		if exclusion {
+			pattern = "!" + pattern
+		}
+
+		patterns = append(patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewDockerIgnore(patterns)
+}
+
+// NewDockerIgnore returns the DockerIgnore for the patterns provided, as read
+// from a .dockerignore file, with exceptions having a leading '!'.
+//
+// A path is ignored if the last pattern matching it, or any of its parent
+// directories, isn't an exception. A '*' or '?' doesn't match '/', whereas
+// '**' matches any number of directories, and a leading or trailing '**'
+// matches any prefix or suffix of the path.
+func NewDockerIgnore(patterns []string) (*DockerIgnore, error) {
+	d := &DockerIgnore{}
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		pattern = path.Clean(pattern)
+
+		var p dockerPattern
+		if pattern[0] == '!' {
+			if len(pattern) == 1 {
+				return nil, errors.New(`matcher: illegal exclusion pattern: "!"`)
+			}
+			p.exclusion = true
+			pattern = pattern[1:]
+		}
+
+		if _, err := filepath.Match(pattern, "."); err != nil {
+			return nil, err
+		}
+
+		p.pattern = pattern
+		if err := p.compile(); err != nil {
+			return nil, err
+		}
+
+		d.patterns = append(d.patterns, p)
+	}
+
+	return d, nil
+}
+
+// compile determines how the pattern is matched, and the regular expression
+// for patterns that aren't matched exactly, or as a prefix or suffix.
+func (p *dockerPattern) compile() error {
+	var b strings.Builder
+	b.WriteString(`^`)
+
+	p.matchType = dockerExact
+	pattern := []rune(p.pattern)
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			start := i == 0
+			i++
+
+			// '**/' is treated as '**'
+			if i+1 < len(pattern) && pattern[i+1] == '/' {
+				i++
+			}
+
+			switch {
+			case i+1 < len(pattern):
+				b.WriteString(`(.*/)?`)
+				p.matchType = dockerRegexp
+
+			case p.matchType == dockerExact:
+				p.matchType = dockerPrefix
+
+			default:
+				b.WriteString(`.*`)
+				p.matchType = dockerRegexp
+			}
+
+			if start {
+				p.matchType = dockerSuffix
+			}
+
+		case c == '*':
+			b.WriteString(`[^/]*`)
+			p.matchType = dockerRegexp
+
+		case c == '?':
+			b.WriteString(`[^/]`)
+			p.matchType = dockerRegexp
+
+		case c == '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(`\` + string(pattern[i]))
+			} else {
+				b.WriteString(`\\`)
+			}
+
+		case c == '[' || c == ']':
+			b.WriteRune(c)
+			p.matchType = dockerRegexp
+
+		case strings.ContainsRune(".+()|{}$", c):
+			b.WriteString(`\` + string(c))
+
+		default:
+			b.WriteRune(c)
+		}
+	}
+	b.WriteString(`$`)
+
+	if p.matchType != dockerRegexp {
+		return nil
+	}
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return err
+	}
+	p.regexp = re
+
+	return nil
+}
+
+func (p *dockerPattern) match(pathname string) bool {
+	switch p.matchType {
+	case dockerExact:
+		return pathname == p.pattern
+
+	case dockerPrefix:
+		return strings.HasPrefix(pathname, p.pattern[:len(p.pattern)-2])
+
+	case dockerSuffix:
+		suffix := p.pattern[2:]
+		if strings.HasSuffix(pathname, suffix) {
+			return true
+		}
+
+		// '**/name' matches 'name'
+		return strings.HasPrefix(suffix, separator) && pathname == suffix[1:]
+	}
+
+	return p.regexp.MatchString(pathname)
+}
+
+// Ignored returns whether a path is excluded from the build context.
+func (d *DockerIgnore) Ignored(pathname string) bool {
+	pathname = path.Clean(filepath.ToSlash(pathname))
+
+	var parents []string
+	if parent := path.Dir(pathname); parent != "." {
+		parents = strings.Split(parent, separator)
+	}
+
+	ignored := false
+	for _, p := range d.patterns {
+		// only exceptions can change whether an ignored path is ignored
+		if p.exclusion != ignored {
+			continue
+		}
+
+		matched := p.match(pathname)
+		for i := range parents {
+			if matched {
+				break
+			}
+			matched = p.match(strings.Join(parents[:i+1], separator))
+		}
+
+		if matched {
+			ignored = !p.exclusion
+		}
+	}
+
+	return ignored
+}
+
+// Match returns Matched for paths included in the build context.
+//
+// Like Docker, an ignored directory is only descended into, with Follow, when
+// an exception begins with its path. For example, with 'vendor' and
+// '!vendor/keep', Follow is returned for 'vendor/', but with '!**/keep',
+// NotMatched is.
+func (d *DockerIgnore) Match(pathname string) (Result, error) {
+	dir := strings.HasSuffix(pathname, separator)
+	pathname = strings.TrimSuffix(pathname, separator)
+
+	if !d.Ignored(pathname) {
+		return Matched, nil
+	}
+
+	if dir {
+		prefix := path.Clean(filepath.ToSlash(pathname)) + separator
+		for _, p := range d.patterns {
+			if p.exclusion && strings.HasPrefix(p.pattern+separator, prefix) {
+				return Follow, nil
+			}
+		}
+	}
+
+	return NotMatched, nil
+}
+
+// DockerContext returns the files and directories below root included in a
+// build context by the .dockerignore provided, as paths relative to root,
+// sorted, and with directories having a trailing '/'.
+func DockerContext(ctx context.Context, root string, ignore *DockerIgnore, opts ...GlobOption) ([]string, error) {
+	matches, err := Glob(ctx, root, ignore, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(matches))
+	for pathname, fi := range matches {
+		rel, err := filepath.Rel(root, pathname)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if fi.IsDir() {
+			rel += separator
+		}
+		paths = append(paths, rel)
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
@@ -0,0 +1,518 @@
+package matcher
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EditorConfig is a parsed .editorconfig file.
+type EditorConfig struct {
+	// Root is whether the file is the top-most .editorconfig, set with
+	// 'root = true' before any section.
+	Root     bool
+	Sections []EditorConfigSection
+}
+
+// EditorConfigSection is a section of an .editorconfig file, with the
+// properties it sets for the files its glob matches.
+type EditorConfigSection struct {
+	Glob       string
+	Properties []EditorConfigProperty
+
+	matcher Matcher
+}
+
+// EditorConfigProperty is a property set by an .editorconfig file. Names, and
+// the values of properties defined by the EditorConfig specification, are
+// lowercased.
+type EditorConfigProperty struct {
+	Name, Value string
+}
+
+// editorconfigProperties are the properties defined by the specification,
+// with case-insensitive values.
+var editorconfigProperties = map[string]bool{
+	"indent_style":             true,
+	"indent_size":              true,
+	"tab_width":                true,
+	"end_of_line":              true,
+	"charset":                  true,
+	"trim_trailing_whitespace": true,
+	"insert_final_newline":     true,
+	"root":                     true,
+}
+
+// NewEditorConfigSection returns a Matcher for the glob of an .editorconfig
+// section, matching paths relative to the directory of the .editorconfig
+// file.
+//
+// A '*' or '?' matches any characters, or any character, except '/', whereas
+// '**' matches any characters including '/'. '[name]' and '[!name]' match any
+// character in or not in name, '{s1,s2,s3}' matches any of the strings, which
+// can themselves use wildcards and braces, and '{num1..num2}' matches any
+// integer between num1 and num2. A glob without a '/' matches a file's base
+// name at any depth. As with NewGitHubFilter, each alternative can have at
+// most 8 '**' within segments.
+func NewEditorConfigSection(glob string) (Matcher, error) {
+	anchored := strings.Contains(editorconfigOutsideBrackets(glob), separator)
+
+	var matchers []Matcher
+	segments := make(editorconfigSegments)
+	for _, alternative := range editorconfigBraces(glob) {
+		if anchored {
+			alternative = strings.TrimPrefix(alternative, separator)
+		} else {
+			alternative = globstar + separator + alternative
+		}
+
+		expanded, err := expandGlobstars(alternative)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pattern := range expanded {
+			for _, segment := range strings.Split(pattern, separator) {
+				if _, ok := segments[segment]; ok || segment == globstar {
+					continue
+				}
+
+				p, err := editorconfigSegment(segment)
+				if err != nil {
+					return nil, err
+				}
+				segments[segment] = p
+			}
+			matchers = append(matchers, New(pattern, WithMatchFunc(segments.match)))
+		}
+	}
+
+	return Multi(matchers...), nil
+}
+
+// editorconfigOutsideBrackets returns the glob without the contents of any
+// brackets.
+func editorconfigOutsideBrackets(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			i++
+
+		case '[':
+			if end := editorconfigBracket(glob[i:]); end > 1 {
+				i += end
+				continue
+			}
+			b.WriteByte(glob[i])
+
+		default:
+			b.WriteByte(glob[i])
+		}
+	}
+
+	return b.String()
+}
+
+// editorconfigBracket returns the offset of the ']' closing the bracket at the
+// start of the glob, or -1 if it isn't closed.
+func editorconfigBracket(glob string) int {
+	for i := 1; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+
+	return -1
+}
+
+var editorconfigRange = regexp.MustCompile(`^\{([+-]?[0-9]+)\.\.([+-]?[0-9]+)\}`)
+
+// editorconfigBraces expands the braces of a glob into each alternative,
+// leaving numeric ranges and braces without alternatives, such as '{single}',
+// in place.
+func editorconfigBraces(glob string) []string {
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			i++
+			continue
+
+		case '{':
+		default:
+			continue
+		}
+
+		if loc := editorconfigRange.FindStringIndex(glob[i:]); loc != nil {
+			i += loc[1] - 1
+			continue
+		}
+
+		// find the alternatives within the matching closing brace
+		var (
+			alternatives []string
+			depth        = 0
+			start        = i + 1
+			end          = -1
+		)
+	scan:
+		for j := i + 1; j < len(glob); j++ {
+			switch glob[j] {
+			case '\\':
+				j++
+			case '{':
+				depth++
+			case '}':
+				if depth == 0 {
+					end = j
+					break scan
+				}
+				depth--
+			case ',':
+				if depth == 0 {
+					alternatives = append(alternatives, glob[start:j])
+					start = j + 1
+				}
+			}
+		}
+
+		if end < 0 {
+			break
+		}
+		if alternatives == nil {
+			continue
+		}
+		alternatives = append(alternatives, glob[start:end])
+
+		var expanded []string
+		for _, alternative := range alternatives {
+			for _, suffix := range editorconfigBraces(alternative + glob[end+1:]) {
+				expanded = append(expanded, glob[:i]+suffix)
+			}
+		}
+
+		return expanded
+	}
+
+	return []string{glob}
+}
+
+// editorconfigPattern is a compiled segment of an .editorconfig glob, with the
+// bounds of each numeric range captured by the regular expression.
+type editorconfigPattern struct {
+	regexp *regexp.Regexp
+	ranges [][2]int
+}
+
+// editorconfigSegments are the compiled segments of a section's glob.
+type editorconfigSegments map[string]*editorconfigPattern
+
+// match matches a path segment with a segment of the glob.
+func (s editorconfigSegments) match(pattern, name string) (bool, error) {
+	p, ok := s[pattern]
+	if !ok {
+		return false, path.ErrBadPattern
+	}
+
+	match := p.regexp.FindStringSubmatch(name)
+	if match == nil {
+		return false, nil
+	}
+
+	for i, bounds := range p.ranges {
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil || n < bounds[0] || n > bounds[1] {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// editorconfigSegment compiles a segment of an .editorconfig glob.
+func editorconfigSegment(pattern string) (*editorconfigPattern, error) {
+	p := &editorconfigPattern{}
+
+	var b strings.Builder
+	b.WriteString(`^`)
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+
+		case '*':
+			b.WriteString(`[^/]*`)
+
+		case '?':
+			b.WriteString(`[^/]`)
+
+		case '[':
+			// an unclosed or empty bracket is matched literally
+			end := editorconfigBracket(pattern[i:])
+			if end < 2 {
+				b.WriteString(`\[`)
+				break
+			}
+			class := pattern[i+1 : i+end]
+			i += end
+
+			b.WriteString(`[`)
+			if strings.HasPrefix(class, "!") || strings.HasPrefix(class, "^") {
+				b.WriteString(`^/`)
+				class = class[1:]
+			}
+			for j := 0; j < len(class); j++ {
+				if class[j] == '\\' && j+1 < len(class) {
+					j++
+				}
+				if j+2 < len(class) && class[j+1] == '-' {
+					if class[j] > class[j+2] {
+						return nil, errors.New("matcher: invalid range in .editorconfig glob")
+					}
+					b.WriteString(regexp.QuoteMeta(class[j:j+1]) + `-` + regexp.QuoteMeta(class[j+2:j+3]))
+					j += 2
+					continue
+				}
+				if class[j] == '-' {
+					b.WriteString(`\-`)
+					continue
+				}
+				b.WriteString(regexp.QuoteMeta(class[j : j+1]))
+			}
+			b.WriteString(`]`)
+
+		case '{':
+			match := editorconfigRange.FindStringSubmatch(pattern[i:])
+			if match == nil {
+				b.WriteString(`\{`)
+				break
+			}
+
+			lo, err := strconv.Atoi(match[1])
+			if err != nil {
+				return nil, err
+			}
+			hi, err := strconv.Atoi(match[2])
+			if err != nil {
+				return nil, err
+			}
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+
+			b.WriteString(`([+-]?[0-9]+)`)
+			p.ranges = append(p.ranges, [2]int{lo, hi})
+			i += len(match[0]) - 1
+
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString(`$`)
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, err
+	}
+	p.regexp = re
+
+	return p, nil
+}
+
+// ParseEditorConfig reads an .editorconfig file. Lines beginning with '#' or
+// ';' are comments, and invalid lines are ignored, as are sections with an
+// invalid glob, along with their properties.
+func ParseEditorConfig(r io.Reader) (*EditorConfig, error) {
+	config := &EditorConfig{}
+
+	var (
+		section *EditorConfigSection
+		skip    bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+
+		case line[0] == '[' && line[len(line)-1] == ']':
+			glob := line[1 : len(line)-1]
+			m, err := NewEditorConfigSection(glob)
+			if err != nil {
+				section, skip = nil, true
+				continue
+			}
+
+			skip = false
+			config.Sections = append(config.Sections, EditorConfigSection{Glob: glob, matcher: m})
+			section = &config.Sections[len(config.Sections)-1]
+
+		default:
+			i := strings.IndexByte(line, '=')
+			if i < 0 || skip {
+				continue
+			}
+
+			name := strings.ToLower(strings.TrimSpace(line[:i]))
+			value := strings.TrimSpace(line[i+1:])
+			if editorconfigProperties[name] {
+				value = strings.ToLower(value)
+			}
+
+			if section == nil {
+				if name == "root" {
+					config.Root = value == "true"
+				}
+				continue
+			}
+
+			section.Properties = append(section.Properties, EditorConfigProperty{Name: name, Value: value})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Match returns whether the section applies to a path, relative to the
+// directory of the .editorconfig file.
+func (s EditorConfigSection) Match(pathname string) (Result, error) {
+	if s.matcher == nil {
+		return NotMatched, nil
+	}
+
+	return s.matcher.Match(pathname)
+}
+
+// ResolveEditorConfig returns the properties for a file, collected from the
+// .editorconfig files of its directory and each parent directory, up to and
+// including one that is the root.
+//
+// Properties are merged in precedence order, with those of closer files, and
+// later sections, overriding earlier ones. Each property appears once, in the
+// order its value was last set. As the specification requires, an indent_size
+// of 'tab' resolves to the tab_width, and an unset tab_width or indent_size is
+// set from the other.
+func ResolveEditorConfig(filename string) ([]EditorConfigProperty, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct {
+		dir    string
+		config *EditorConfig
+	}
+
+	var files []file
+	for dir := filepath.Dir(filename); ; {
+		config, err := readEditorConfig(filepath.Join(dir, ".editorconfig"))
+		if err != nil {
+			return nil, err
+		}
+		if config != nil {
+			files = append(files, file{dir, config})
+			if config.Root {
+				break
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	var properties []EditorConfigProperty
+	set := func(name, value string) {
+		for i, property := range properties {
+			if property.Name == name {
+				properties = append(properties[:i], properties[i+1:]...)
+				break
+			}
+		}
+		properties = append(properties, EditorConfigProperty{name, value})
+	}
+	get := func(name string) (string, bool) {
+		for _, property := range properties {
+			if property.Name == name {
+				return property.Value, true
+			}
+		}
+		return "", false
+	}
+
+	// files closest to the root have the lowest precedence
+	for i := len(files) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(files[i].dir, filename)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+
+		for _, section := range files[i].config.Sections {
+			result, err := section.Match(rel)
+			if err != nil {
+				return nil, err
+			}
+			if !result.Matched() {
+				continue
+			}
+
+			for _, property := range section.Properties {
+				set(property.Name, property.Value)
+			}
+		}
+	}
+
+	indentStyle, _ := get("indent_style")
+	indentSize, hasIndentSize := get("indent_size")
+	tabWidth, hasTabWidth := get("tab_width")
+
+	if indentStyle == "tab" && !hasIndentSize {
+		indentSize, hasIndentSize = "tab", true
+		set("indent_size", indentSize)
+	}
+
+	switch {
+	case indentSize == "tab" && hasTabWidth:
+		set("indent_size", tabWidth)
+
+	case hasIndentSize && indentSize != "tab" && !hasTabWidth:
+		set("tab_width", indentSize)
+	}
+
+	return properties, nil
+}
+
+// readEditorConfig reads an .editorconfig file, returning nil if it doesn't
+// exist.
+func readEditorConfig(filename string) (*EditorConfig, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseEditorConfig(f)
+}
@@ -0,0 +1,404 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func addMatchTestsCorpus(f *testing.F, add func(pattern, pathname string)) {
+	for _, tests := range matchTests {
+		for _, tt := range tests {
+			add(tt.pattern, tt.s)
+		}
+	}
+}
+
+// FuzzMatch checks that patterns without globstar agree with path.Match.
+func FuzzMatch(f *testing.F) {
+	addMatchTestsCorpus(f, func(pattern, pathname string) {
+		f.Add(pattern, pathname)
+	})
+
+	f.Fuzz(func(t *testing.T, pattern, pathname string) {
+		for _, segment := range strings.Split(pattern, separator) {
+			if segment == globstar {
+				return
+			}
+		}
+
+		// path.Match allows character classes to match, and escapes to
+		// escape, a '/', whereas patterns here are always split on it
+		if strings.ContainsAny(pattern, `[\`) && (strings.Contains(pattern, separator) || strings.Contains(pathname, separator)) {
+			return
+		}
+
+		matched, err := Match(pattern, pathname)
+		expected, expectedErr := path.Match(pattern, pathname)
+
+		if matched != expected || (err == nil) != (expectedErr == nil) {
+			t.Errorf("Match(%#q, %#q) = (%v, %v) want (%v, %v)", pattern, pathname, matched, err, expected, expectedErr)
+		}
+	})
+}
+
+// referenceMatch is the original recursive implementation of globstar
+// matching, which can take exponential time, used to check the results of
+// the current implementation.
+func referenceMatch(pattern, parts []string) (Result, error) {
+	for {
+		switch {
+		case len(pattern) == 0 && len(parts) == 0:
+			return Matched, nil
+
+		case len(parts) == 0:
+			return Follow, nil
+
+		case len(pattern) == 0:
+			return NotMatched, nil
+
+		case pattern[0] == globstar && len(pattern) == 1:
+			return Matched, nil
+
+		case pattern[0] == globstar:
+			for i := range parts {
+				result, err := referenceMatch(pattern[1:], parts[i:])
+				if result == Matched || err != nil {
+					return result, err
+				}
+			}
+			return Follow, nil
+		}
+
+		matched, err := path.Match(pattern[0], parts[0])
+		switch {
+		case err != nil:
+			return NotMatched, err
+
+		case !matched && len(parts) == 1 && parts[0] == "":
+			return Follow, nil
+
+		case !matched:
+			return NotMatched, nil
+		}
+
+		pattern = pattern[1:]
+		parts = parts[1:]
+	}
+}
+
+// FuzzNewMatch checks the results of New(...).Match against the reference
+// implementation, that directories leading to a match are never NotMatched,
+// that directories that are Follow have a descendant that can match, and that
+// everything below directories that are MatchedAll is matched. In strict
+// mode, it also checks that Follow agrees with CanMatchBelow.
+func FuzzNewMatch(f *testing.F) {
+	addMatchTestsCorpus(f, func(pattern, pathname string) {
+		f.Add(pattern, pathname, true, false)
+		f.Add(pattern, pathname, false, false)
+		f.Add(pattern, pathname, true, true)
+	})
+
+	f.Fuzz(func(t *testing.T, pattern, pathname string, dotfiles, strict bool) {
+		// the reference implementation is exponential, so keep inputs small
+		if strings.Count(pattern, globstar) > 4 || len(pathname) > 64 {
+			return
+		}
+
+		opts := []MatchOption{WithDotfiles(dotfiles)}
+		if strict {
+			opts = append(opts, WithStrictFollow())
+		}
+		m := New(pattern, opts...)
+
+		result, err := m.Match(pathname)
+		if dotfiles && !strict {
+			expected, expectedErr := referenceMatch(strings.Split(pattern, separator), strings.Split(pathname, separator))
+
+			switch {
+			case expectedErr != nil && err == nil:
+				t.Fatalf("New(%#q).Match(%#q) = (%v, nil) want error %v", pattern, pathname, result, expectedErr)
+
+			// the reference implementation has no notion of MatchedAll
+			case expectedErr == nil && err == nil && result != expected && !(result == MatchedAll && expected == Matched):
+				t.Fatalf("New(%#q).Match(%#q) = %v want %v", pattern, pathname, result, expected)
+			}
+		}
+		if err != nil {
+			return
+		}
+
+		if re, err := ToRegexp(pattern, opts...); !errors.Is(err, ErrUntranslatable) && (err != nil || re.MatchString(pathname) != result.Matched()) {
+			t.Fatalf("ToRegexp(%#q) = (%v, %v), but New(%#q).Match(%#q) = %v", pattern, re, err, pattern, pathname, result)
+		}
+
+		// in strict mode, a directory can't have an entry with an empty name
+		if result.Matched() && !(strict && strings.Contains(pathname, "//")) {
+			for i := 0; i < len(pathname)-1; i++ {
+				if pathname[i] != '/' {
+					continue
+				}
+
+				dir := pathname[:i+1]
+				if result, _ := m.Match(dir); result == NotMatched {
+					t.Fatalf("New(%#q).Match(%#q) = %v, but %#q is Matched", pattern, dir, result, pathname)
+				}
+			}
+		}
+
+		// CanMatchBelow treats an empty directory as the root, so paths with
+		// empty names are skipped
+		if strict && strings.HasSuffix(pathname, separator) && !result.Matched() && !strings.Contains(separator+pathname[:len(pathname)-1]+separator, "//") {
+			below := m.(DescendantMatcher).CanMatchBelow(pathname)
+			if below != (result == Follow) {
+				t.Fatalf("New(%#q, WithStrictFollow()).Match(%#q) = %v, but CanMatchBelow is %v", pattern, pathname, result, below)
+			}
+		}
+
+		// substituting the captures into the pattern should give the path,
+		// unless it has empty names that a globstar could capture
+		if result.Matched() && !strings.Contains(separator+strings.TrimSuffix(pathname, separator)+separator, "//") {
+			_, captures, _ := m.(CaptureMatcher).MatchCapture(pathname)
+			if expanded, ok := expandCaptures(pattern, captures); !ok || strings.TrimSuffix(expanded, separator) != strings.TrimSuffix(pathname, separator) {
+				t.Fatalf("New(%#q).MatchCapture(%#q) captured %q", pattern, pathname, captures)
+			}
+		}
+
+		if result == MatchedAll {
+			for _, descendant := range []string{"x", "x/", ".x/", "x/.y", "x/y/z"} {
+				if result, _ := m.Match(pathname + descendant); !result.Matched() {
+					t.Fatalf("New(%#q).Match(%#q) = %v, but %#q is MatchedAll", pattern, pathname+descendant, result, pathname)
+				}
+			}
+		}
+
+		if result == Follow && strings.HasSuffix(pathname, separator) {
+			descendants, ok := descendantCandidates(pathname, strings.Split(pattern, separator), !dotfiles)
+			if !ok {
+				return
+			}
+
+			for _, descendant := range descendants {
+				if result, _ := m.Match(descendant); result.Matched() {
+					return
+				}
+			}
+
+			t.Fatalf("New(%#q).Match(%#q) = Follow, but none of %q match", pattern, pathname, descendants)
+		}
+	})
+}
+
+// descendantCandidates returns paths below a directory that are built from
+// each suffix of the pattern, such that one should match if any descendant
+// can. If a pattern segment is too complex to generate a name for, ok is
+// false.
+func descendantCandidates(dir string, pattern []string, noDotfiles bool) (candidates []string, ok bool) {
+	names := make([]string, len(pattern))
+	for i, segment := range pattern {
+		switch {
+		case segment == globstar && i == len(pattern)-1:
+			names[i] = "x"
+
+		case segment == globstar:
+			names[i] = ""
+
+		case segment == "" && i == len(pattern)-1:
+			// a trailing separator, matching directories
+
+		case segment == "" || strings.Contains(segment, "["):
+			return nil, false
+
+		default:
+			var name strings.Builder
+			for j := 0; j < len(segment); j++ {
+				switch segment[j] {
+				case '\\':
+					j++
+					name.WriteByte(segment[j])
+				case '?':
+					name.WriteByte('x')
+				case '*':
+				default:
+					name.WriteByte(segment[j])
+				}
+			}
+
+			names[i] = name.String()
+			if names[i] == "" || (noDotfiles && strings.HasPrefix(names[i], ".") && !explicitlyHidden(segment)) {
+				names[i] = "x" + names[i]
+			}
+			if matched, _ := path.Match(segment, names[i]); !matched {
+				return nil, false
+			}
+		}
+	}
+
+	for i := range pattern {
+		var suffix []string
+		for j, name := range names[i:] {
+			if pattern[i+j] != globstar || name != "" {
+				suffix = append(suffix, name)
+			}
+		}
+
+		if descendant := strings.Join(suffix, separator); descendant != "" {
+			candidates = append(candidates, dir+descendant)
+		}
+	}
+
+	return candidates, true
+}
+
+// expandCaptures replaces each wildcard of a pattern with its capture. If
+// there are too few or too many captures, ok is false.
+func expandCaptures(pattern string, captures []string) (expanded string, ok bool) {
+	var segments []string
+	for _, segment := range strings.Split(pattern, separator) {
+		if segment == globstar {
+			if len(captures) == 0 {
+				return "", false
+			}
+			if captures[0] != "" {
+				segments = append(segments, captures[0])
+			}
+			captures = captures[1:]
+			continue
+		}
+
+		var s strings.Builder
+		for i := 0; i < len(segment); i++ {
+			switch segment[i] {
+			case '*', '?', '[':
+				if len(captures) == 0 {
+					return "", false
+				}
+				s.WriteString(captures[0])
+				captures = captures[1:]
+
+				if segment[i] == '[' {
+					i += classLen(segment[i:]) - 1
+				}
+
+			case '\\':
+				i++
+				s.WriteByte(segment[i])
+
+			default:
+				s.WriteByte(segment[i])
+			}
+		}
+		segments = append(segments, s.String())
+	}
+
+	return strings.Join(segments, separator), len(captures) == 0
+}
+
+// fuzzTree returns a tree of Multi and Exclude matchers for up to 4 newline
+// separated patterns. For each pattern after the first, a pair of bits of the
+// shape choose whether it's combined with the tree so far using Exclude or
+// Multi, and in which order.
+func fuzzTree(patterns string, shape uint8, opts ...MatchOption) Matcher {
+	var m Matcher
+	for i, pattern := range strings.SplitN(patterns, "\n", 4) {
+		p := New(pattern, opts...)
+		if i == 0 {
+			m = p
+			continue
+		}
+
+		bits := shape >> (2 * (i - 1))
+
+		a, b := m, p
+		if bits&2 != 0 {
+			a, b = b, a
+		}
+
+		if bits&1 != 0 {
+			m = Exclude(a, b)
+		} else {
+			m = Multi(a, b)
+		}
+	}
+
+	return m
+}
+
+// FuzzGlob checks that Glob finds exactly the same files and directories as
+// walking every path below directories that are matched or followed, and
+// matching each, with a single matcher or a tree of Multi and Exclude
+// matchers.
+func FuzzGlob(f *testing.F) {
+	dir := f.TempDir()
+
+	for _, name := range []string{"a/b/d/", "a/.hidden/", "c/d/e/", "files/dir1/"} {
+		os.MkdirAll(filepath.Join(dir, filepath.FromSlash(name)), 0o777)
+	}
+	for _, name := range []string{"top.txt", "a/x.txt", "a/x.go", "a/b/y.txt", "a/b/d.txt", "a/.hidden/z.go", "c/d.go", "c/d/e/f.go", "files/dir1/file1.txt"} {
+		os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte{}, 0o600)
+	}
+
+	addMatchTestsCorpus(f, func(pattern, pathname string) {
+		f.Add(pattern, uint8(0), true)
+	})
+	f.Add("**/*.go", uint8(0), false)
+	f.Add("a/**", uint8(0), false)
+	f.Add("**\na/\na/", uint8(1), true)
+	f.Add("a/**\na/b/\n**/*.txt\nc/", uint8(0b100111), true)
+	f.Add("**/*.txt\na/**\na/b/**", uint8(0b1001), false)
+
+	f.Fuzz(func(t *testing.T, patterns string, shape uint8, dotfiles bool) {
+		m := fuzzTree(patterns, shape, WithDotfiles(dotfiles))
+
+		var expected []string
+		err := filepath.WalkDir(dir, func(pathname string, d fs.DirEntry, err error) error {
+			if err != nil || pathname == dir {
+				return err
+			}
+
+			rel, _ := filepath.Rel(dir, pathname)
+			rel = filepath.ToSlash(rel)
+			if d.IsDir() {
+				rel += "/"
+			}
+
+			result, err := m.Match(rel)
+			if result.Matched() {
+				expected = append(expected, pathname)
+			}
+
+			// nothing below a directory that isn't matched or followed is
+			// matched
+			if err == nil && d.IsDir() && result == NotMatched {
+				return filepath.SkipDir
+			}
+			return err
+		})
+		if err != nil {
+			return
+		}
+
+		matches, err := Glob(context.Background(), dir, m)
+		if err != nil {
+			t.Fatalf("Glob(%#q, %v) returned %v", patterns, shape, err)
+		}
+
+		var pathnames []string
+		for pathname := range matches {
+			pathnames = append(pathnames, pathname)
+		}
+		sort.Strings(pathnames)
+		sort.Strings(expected)
+
+		if !reflect.DeepEqual(pathnames, expected) {
+			t.Fatalf("Glob(%#q, %v) = %q want %q", patterns, shape, pathnames, expected)
+		}
+	})
+}
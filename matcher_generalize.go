@@ -0,0 +1,344 @@
+package matcher
+
+import (
+	"container/heap"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Generalize returns a small set of patterns that together match every path
+// provided, and none of the negative paths provided by WithNegatives, as
+// verified by the Matchers returned by New. Directories have a trailing '/'.
+//
+// Patterns are built from each path's extension, parent directories and '**',
+// such as 'src/*.go', 'src/**/*.go', 'src/**' and '**/Makefile', falling back
+// to the path itself. They're chosen greedily, preferring patterns that match
+// the most paths, then the most specific. Paths that are also negative paths
+// are not matched.
+//
+// Paths are indexed by their directories, names and extensions, so each
+// pattern is only matched against the paths it could match. For a whole
+// repository, this takes time roughly proportional to the number of paths
+// multiplied by their depth.
+func Generalize(paths []string, opts ...GeneralizeOption) []string {
+	var o generalizeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	excluded := make(map[string]bool)
+	for _, pathname := range o.Negatives {
+		excluded[pathname] = true
+	}
+
+	var positives []string
+	for _, pathname := range paths {
+		if !excluded[pathname] {
+			excluded[pathname] = true
+			positives = append(positives, pathname)
+		}
+	}
+
+	pos := newPathIndex(positives)
+	neg := newPathIndex(o.Negatives)
+
+	// candidates matching no negative paths, and the positive paths they
+	// match
+	var candidates []generalization
+	tried := make(map[string]bool)
+	for _, pathname := range pos.paths {
+		for _, c := range generalizations(pathname) {
+			if tried[c.pattern] {
+				continue
+			}
+			tried[c.pattern] = true
+
+			m := New(c.pattern)
+			if neg.matchesAny(m, c) {
+				continue
+			}
+
+			c.matches = pos.matching(m, c)
+			candidates = append(candidates, c)
+		}
+	}
+
+	// the number of paths a candidate matches that aren't yet covered only
+	// decreases as candidates are chosen, so candidates are kept in order of
+	// the number last counted, and only counted again once they're the best
+	covered := make([]int, len(pos.paths))
+	uncovered := func(c *generalization) int {
+		n := 0
+		for _, j := range c.matches {
+			if covered[j] == 0 {
+				n++
+			}
+		}
+		return n
+	}
+
+	queue := make(generalizationQueue, len(candidates))
+	for i := range candidates {
+		candidates[i].gain = len(candidates[i].matches)
+		queue[i] = &candidates[i]
+	}
+	heap.Init(&queue)
+
+	var chosen []*generalization
+	for remaining := len(pos.paths); remaining > 0 && queue.Len() > 0; {
+		best := heap.Pop(&queue).(*generalization)
+
+		best.gain = uncovered(best)
+		if best.gain == 0 {
+			continue
+		}
+		if queue.Len() > 0 && queue.better(queue[0], best) {
+			heap.Push(&queue, best)
+			continue
+		}
+
+		for _, j := range best.matches {
+			if covered[j] == 0 {
+				remaining--
+			}
+			covered[j]++
+		}
+		chosen = append(chosen, best)
+	}
+
+	// a pattern chosen early can be made redundant by later ones
+	var patterns []string
+	for i := len(chosen) - 1; i >= 0; i-- {
+		redundant := true
+		for _, j := range chosen[i].matches {
+			if covered[j] == 1 {
+				redundant = false
+				break
+			}
+		}
+
+		if !redundant {
+			patterns = append(patterns, chosen[i].pattern)
+			continue
+		}
+
+		for _, j := range chosen[i].matches {
+			covered[j]--
+		}
+	}
+
+	sort.Strings(patterns)
+
+	return patterns
+}
+
+// generalization is a candidate pattern for a path. Every path the pattern
+// can match begins with prefix and, if set, has the name or extension
+// provided.
+type generalization struct {
+	pattern string
+
+	prefix, name, ext string
+
+	// matches are the indexes of the positive paths matched
+	matches []int
+
+	// gain is the number of matches last counted that aren't yet covered
+	gain int
+}
+
+// generalizationQueue is a heap of candidates, ordered by gain, then by how
+// specific they are.
+type generalizationQueue []*generalization
+
+func (q generalizationQueue) better(a, b *generalization) bool {
+	if a.gain != b.gain {
+		return a.gain > b.gain
+	}
+	return moreSpecific(a.pattern, b.pattern)
+}
+
+func (q generalizationQueue) Len() int           { return len(q) }
+func (q generalizationQueue) Less(i, j int) bool { return q.better(q[i], q[j]) }
+func (q generalizationQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *generalizationQueue) Push(x interface{}) {
+	*q = append(*q, x.(*generalization))
+}
+
+func (q *generalizationQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// generalizations returns the candidate patterns for a path.
+func generalizations(pathname string) []generalization {
+	dir := strings.HasSuffix(pathname, separator)
+	name := path.Base(pathname)
+
+	raw := strings.Split(strings.TrimSuffix(pathname, separator), separator)
+	segments := make([]string, len(raw))
+	for i, segment := range raw {
+		segments[i] = escape(segment)
+	}
+
+	key := name
+	if dir {
+		key += separator
+	}
+
+	candidates := []generalization{
+		{pattern: strings.Join(segments, separator), prefix: pathname, name: key},
+		{pattern: globstar + separator + escape(name), name: key},
+	}
+	if dir {
+		candidates[0].pattern += separator
+		candidates[1].pattern += separator
+	}
+
+	// a directory is an ancestor of itself
+	ancestors := len(segments)
+	if !dir {
+		ancestors--
+	}
+
+	ext := path.Ext(name)
+	if dir || ext == name {
+		ext = ""
+	}
+
+	for i := ancestors; i >= 0; i-- {
+		pattern := strings.Join(segments[:i], separator) + separator
+		prefix := strings.Join(raw[:i], separator) + separator
+		if i == 0 {
+			pattern, prefix = "", ""
+		}
+
+		if ext != "" {
+			if i == len(segments)-1 {
+				candidates = append(candidates, generalization{pattern: pattern + "*" + escape(ext), prefix: prefix, ext: ext})
+			}
+			candidates = append(candidates, generalization{pattern: pattern + globstar + separator + "*" + escape(ext), prefix: prefix, ext: ext})
+		}
+
+		if i > 0 {
+			candidates = append(candidates, generalization{pattern: pattern + globstar, prefix: prefix})
+		}
+	}
+
+	return candidates
+}
+
+// pathIndex holds sorted paths, with the indexes of the files having each
+// extension, and of the paths having each name, with directories' names
+// having a trailing '/'.
+type pathIndex struct {
+	paths []string
+	all   []int
+	names map[string][]int
+	exts  map[string][]int
+}
+
+func newPathIndex(paths []string) *pathIndex {
+	x := &pathIndex{
+		paths: append([]string(nil), paths...),
+		names: make(map[string][]int),
+		exts:  make(map[string][]int),
+	}
+	sort.Strings(x.paths)
+
+	x.all = make([]int, len(x.paths))
+	for i, pathname := range x.paths {
+		x.all[i] = i
+
+		name := path.Base(pathname)
+		if strings.HasSuffix(pathname, separator) {
+			x.names[name+separator] = append(x.names[name+separator], i)
+			continue
+		}
+
+		x.names[name] = append(x.names[name], i)
+		if ext := path.Ext(name); ext != "" {
+			x.exts[ext] = append(x.exts[ext], i)
+		}
+	}
+
+	return x
+}
+
+// candidates returns the indexes of the paths that the generalization could
+// match.
+func (x *pathIndex) candidates(c generalization) []int {
+	list := x.all
+	switch {
+	case c.name != "":
+		list = x.names[c.name]
+	case c.ext != "":
+		list = x.exts[c.ext]
+	}
+
+	// the indexes are in the same order as the sorted paths, so those with
+	// the prefix are together
+	i := sort.Search(len(list), func(i int) bool {
+		return x.paths[list[i]] >= c.prefix
+	})
+	j := i
+	for j < len(list) && strings.HasPrefix(x.paths[list[j]], c.prefix) {
+		j++
+	}
+
+	return list[i:j]
+}
+
+// matching returns the indexes of the paths matched.
+func (x *pathIndex) matching(m Matcher, c generalization) []int {
+	var matches []int
+	for _, i := range x.candidates(c) {
+		if result, _ := m.Match(x.paths[i]); result.Matched() {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// matchesAny returns whether any of the paths are matched.
+func (x *pathIndex) matchesAny(m Matcher, c generalization) bool {
+	for _, i := range x.candidates(c) {
+		if result, _ := m.Match(x.paths[i]); result.Matched() {
+			return true
+		}
+	}
+	return false
+}
+
+// escape returns a pattern matching the name literally.
+func escape(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '*', '?', '[', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(name[i])
+	}
+
+	return b.String()
+}
+
+// moreSpecific returns whether pattern a is more specific than b, having
+// fewer globstars, then fewer wildcards, then being longer.
+func moreSpecific(a, b string) bool {
+	if x, y := strings.Count(a, globstar), strings.Count(b, globstar); x != y {
+		return x < y
+	}
+	if x, y := strings.Count(a, "*"), strings.Count(b, "*"); x != y {
+		return x < y
+	}
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a < b
+}
@@ -0,0 +1,311 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// GitHubFilter matches paths with the patterns of a GitHub Actions workflow's
+// paths or paths-ignore filter.
+type GitHubFilter struct {
+	rules []githubRule
+
+	// regexps are the compiled segments of the patterns
+	regexps map[string]*regexp.Regexp
+}
+
+type githubRule struct {
+	negated bool
+	matcher Matcher
+}
+
+// NewGitHubFilter parses the patterns of a GitHub Actions paths or
+// paths-ignore filter.
+//
+// Patterns are evaluated in order, with a path matched if the last pattern
+// matching it isn't negated with a leading '!'. A '*' matches any characters
+// except '/', whilst '**' matches any characters including '/'. As such, a
+// pattern with a leading '*', such as '*.js', only matches files at the root,
+// whilst '**.js' matches files at any depth. A '?' or '+' matches zero or one,
+// or one or more, of the preceding character, and '[]' matches one of the
+// characters or ranges listed. Special characters are escaped with '\'.
+//
+// A '**' within a segment, such as in 'src**test', either matches within the
+// segment or across separators, doubling the patterns matched, so a pattern
+// can have at most 8.
+func NewGitHubFilter(patterns []string) (*GitHubFilter, error) {
+	f := &GitHubFilter{regexps: make(map[string]*regexp.Regexp)}
+
+	for _, pattern := range patterns {
+		var rule githubRule
+		if strings.HasPrefix(pattern, "!") {
+			rule.negated = true
+			pattern = pattern[1:]
+		}
+		if pattern == "" {
+			return nil, errors.New("matcher: empty GitHub Actions path pattern")
+		}
+
+		expanded, err := expandGlobstars(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range expanded {
+			for _, segment := range strings.Split(p, separator) {
+				if _, ok := f.regexps[segment]; ok || segment == globstar {
+					continue
+				}
+
+				re, err := githubRegexp(segment)
+				if err != nil {
+					return nil, err
+				}
+				f.regexps[segment] = re
+			}
+		}
+
+		matchers := make([]Matcher, len(expanded))
+		for i, p := range expanded {
+			matchers[i] = New(p, WithMatchFunc(f.match))
+		}
+		rule.matcher = Multi(matchers...)
+
+		f.rules = append(f.rules, rule)
+	}
+
+	return f, nil
+}
+
+// Match returns Matched for a path matched by the filter. For a directory,
+// with a trailing '/', Follow is returned if a path below could be matched.
+func (f *GitHubFilter) Match(pathname string) (Result, error) {
+	result, possible := NotMatched, false
+
+	for _, rule := range f.rules {
+		r, err := rule.matcher.Match(pathname)
+		if err != nil {
+			return NotMatched, err
+		}
+
+		if r != NotMatched && !rule.negated {
+			possible = true
+		}
+
+		// a later negated pattern can exclude paths below a directory, so
+		// MatchedAll can't be relied upon
+		if r.Matched() {
+			result = Matched
+			if rule.negated {
+				result = NotMatched
+			}
+		}
+	}
+
+	if result == NotMatched && possible && strings.HasSuffix(pathname, separator) {
+		return Follow, nil
+	}
+
+	return result, nil
+}
+
+// AnyMatch returns whether any of the changed paths are matched, which is when
+// a workflow with a paths filter runs.
+func (f *GitHubFilter) AnyMatch(changed []string) (bool, error) {
+	for _, pathname := range changed {
+		result, err := f.Match(pathname)
+		if err != nil || result == Matched {
+			return result == Matched, err
+		}
+	}
+
+	return false, nil
+}
+
+// AllMatch returns whether all of the changed paths are matched, which is when
+// a workflow with a paths-ignore filter doesn't run.
+func (f *GitHubFilter) AllMatch(changed []string) (bool, error) {
+	for _, pathname := range changed {
+		result, err := f.Match(pathname)
+		if err != nil || result != Matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// maxSegmentGlobstars is the most '**' a pattern can have within segments,
+// as each doubles the number of patterns it expands to.
+const maxSegmentGlobstars = 8
+
+// expandGlobstars returns the patterns a pattern expands to, with each '**'
+// within a segment either matching within it, or across separators.
+func expandGlobstars(pattern string) ([]string, error) {
+	n := 0
+	expanded := []string{""}
+	for i, segment := range strings.Split(pattern, separator) {
+		alternatives := []string{globstar}
+		if segment != globstar {
+			pieces := globstarPieces(segment)
+			if n += len(pieces) - 1; n > maxSegmentGlobstars {
+				return nil, fmt.Errorf("matcher: pattern %q has more than %d '**' within segments", pattern, maxSegmentGlobstars)
+			}
+			alternatives = globstarSegments(pieces)
+		}
+
+		var next []string
+		for _, prefix := range expanded {
+			for _, alternative := range alternatives {
+				if i > 0 {
+					alternative = prefix + separator + alternative
+				}
+				next = append(next, alternative)
+			}
+		}
+		expanded = next
+	}
+
+	return expanded, nil
+}
+
+// globstarPieces splits a segment at each '**'.
+func globstarPieces(segment string) []string {
+	var (
+		pieces []string
+		piece  strings.Builder
+	)
+	for i := 0; i < len(segment); i++ {
+		switch {
+		case segment[i] == '\\' && i+1 < len(segment):
+			piece.WriteString(segment[i : i+2])
+			i++
+
+		case strings.HasPrefix(segment[i:], globstar):
+			pieces = append(pieces, piece.String())
+			piece.Reset()
+			for i+1 < len(segment) && segment[i+1] == '*' {
+				i++
+			}
+
+		default:
+			piece.WriteByte(segment[i])
+		}
+	}
+
+	return append(pieces, piece.String())
+}
+
+// globstarSegments returns the alternatives of a segment, split into pieces
+// at each '**', with each '**' either matching within the segment, or across
+// separators.
+func globstarSegments(pieces []string) []string {
+	alternatives := []string{pieces[0]}
+	for _, piece := range pieces[1:] {
+		var next []string
+		for _, alternative := range alternatives {
+			next = append(next, alternative+"*"+piece, alternative+"*/**/*"+piece)
+		}
+		alternatives = next
+	}
+
+	return alternatives
+}
+
+// match matches a path segment with a segment of one of the filter's
+// patterns.
+func (f *GitHubFilter) match(pattern, name string) (bool, error) {
+	re, ok := f.regexps[pattern]
+	if !ok {
+		return false, path.ErrBadPattern
+	}
+
+	return re.MatchString(name), nil
+}
+
+// githubRegexp compiles a segment of a GitHub Actions path pattern into a
+// regular expression. Quantifiers apply to the whole preceding character,
+// rather than its last byte.
+func githubRegexp(segment string) (*regexp.Regexp, error) {
+	pattern := []rune(segment)
+
+	var b strings.Builder
+	b.WriteString(`^`)
+
+	// quantifiable is whether the last term can be followed by a quantifier
+	quantifiable := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '\\':
+			if i+1 == len(pattern) {
+				return nil, path.ErrBadPattern
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			quantifiable = true
+
+		case '*':
+			b.WriteString(`[^/]*`)
+			quantifiable = false
+
+		case '?', '+':
+			if quantifiable {
+				b.WriteRune(c)
+			}
+			quantifiable = false
+
+		case '[':
+			end := runeIndex(pattern[i+1:], ']')
+			if end < 1 {
+				return nil, path.ErrBadPattern
+			}
+			class := pattern[i+1 : i+1+end]
+			i += end + 1
+
+			b.WriteString(`[`)
+			for j := 0; j < len(class); j++ {
+				if j+2 < len(class) && class[j+1] == '-' {
+					if class[j] > class[j+2] {
+						return nil, path.ErrBadPattern
+					}
+					b.WriteString(regexp.QuoteMeta(string(class[j])) + `-` + regexp.QuoteMeta(string(class[j+2])))
+					j += 2
+					continue
+				}
+				if class[j] == '-' {
+					b.WriteString(`\-`)
+					continue
+				}
+				b.WriteString(regexp.QuoteMeta(string(class[j])))
+			}
+			b.WriteString(`]`)
+			quantifiable = true
+
+		default:
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			quantifiable = true
+		}
+	}
+	b.WriteString(`$`)
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, path.ErrBadPattern
+	}
+
+	return re, nil
+}
+
+// runeIndex returns the index of the first r in runes, or -1 if it isn't
+// present.
+func runeIndex(runes []rune, r rune) int {
+	for i, c := range runes {
+		if c == r {
+			return i
+		}
+	}
+
+	return -1
+}
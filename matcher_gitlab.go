@@ -0,0 +1,136 @@
+package matcher
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GitLabArtifacts returns the files and directories below root that GitLab
+// Runner archives for a job's artifacts:paths and artifacts:exclude, as paths
+// relative to root, sorted, and with directories having a trailing '/'.
+//
+// As with the runner, a directory matched by a path includes everything below
+// it, and excludes are applied to each path afterwards, so excluding a
+// directory doesn't exclude its contents unless the pattern matches them too,
+// such as 'build/**'. Patterns are cleaned, and those referring to paths
+// outside of root are ignored.
+func GitLabArtifacts(ctx context.Context, root string, paths, exclude []string, opts ...GlobOption) ([]string, error) {
+	var (
+		includes []Matcher
+		dirs     []Matcher
+		excludes []Matcher
+	)
+
+	for _, pattern := range paths {
+		pattern, ok := gitlabPattern(root, pattern)
+		if !ok {
+			continue
+		}
+
+		// a directory matched is archived along with everything below it
+		contents := New(pattern + separator + globstar)
+		includes = append(includes, New(pattern), contents)
+		dirs = append(dirs, contents)
+	}
+
+	for _, pattern := range exclude {
+		if pattern, ok := gitlabPattern(root, pattern); ok {
+			excludes = append(excludes, New(pattern))
+		}
+	}
+
+	if len(includes) == 0 {
+		return nil, nil
+	}
+
+	matches, err := Glob(ctx, root, Multi(includes...), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var archived []string
+	for pathname, fi := range matches {
+		rel, err := filepath.Rel(root, pathname)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if fi.IsDir() {
+			rel += separator
+
+			// a pattern's final segment matching the empty name after a
+			// directory's trailing separator isn't a match for the runner
+			if result, err := Multi(dirs...).Match(rel); err != nil || !result.Matched() {
+				continue
+			}
+		}
+
+		excluded, err := gitlabExcluded(excludes, rel)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
+			archived = append(archived, rel)
+		}
+	}
+
+	sort.Strings(archived)
+
+	return archived, nil
+}
+
+// gitlabPattern returns a pattern cleaned and made relative to root, and false
+// if it refers to paths outside of root.
+func gitlabPattern(root, pattern string) (string, bool) {
+	if filepath.IsAbs(pattern) {
+		rel, err := filepath.Rel(root, pattern)
+		if err != nil {
+			return "", false
+		}
+		pattern = rel
+	}
+
+	pattern = path.Clean(filepath.ToSlash(pattern))
+	switch {
+	case pattern == ".":
+		return globstar, true
+
+	case pattern == ".." || strings.HasPrefix(pattern, "../") || strings.HasPrefix(pattern, separator):
+		return "", false
+	}
+
+	return pattern, true
+}
+
+// gitlabExcluded returns whether a path is excluded. The runner matches a
+// directory's path without a trailing separator, which a trailing globstar can
+// match.
+func gitlabExcluded(excludes []Matcher, rel string) (bool, error) {
+	dir := strings.HasSuffix(rel, separator)
+
+	for _, exclude := range excludes {
+		result, err := exclude.Match(strings.TrimSuffix(rel, separator))
+		if err != nil {
+			return false, err
+		}
+		if result.Matched() {
+			return true, nil
+		}
+
+		if dir {
+			result, err := exclude.Match(rel)
+			if err != nil {
+				return false, err
+			}
+			if result == MatchedAll {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
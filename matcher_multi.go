@@ -1,5 +1,10 @@
 package matcher
 
+import (
+	"bytes"
+	"strings"
+)
+
 type multiMatcher []Matcher
 
 // Multi returns a new Matcher that matches against many matchers.
@@ -8,28 +13,154 @@ func Multi(matches ...Matcher) Matcher {
 }
 
 // Match performs a match with all matchers provided and returns a result
-// early if one matched.
+// early if one matched. A directory Matched by one matcher is MatchedAll if
+// any other matcher returns MatchedAll for it.
 func (p multiMatcher) Match(pathname string) (Result, error) {
-	var follow bool
+	return p.match(strings.HasSuffix(pathname, separator), func(m Matcher) (Result, error) {
+		return m.Match(pathname)
+	})
+}
+
+// MatchBytes is the same as Match, but for a path held in a byte slice.
+func (p multiMatcher) MatchBytes(pathname []byte) (Result, error) {
+	return p.match(bytes.HasSuffix(pathname, []byte(separator)), func(m Matcher) (Result, error) {
+		return matchBytes(m, pathname)
+	})
+}
+
+func (p multiMatcher) match(dir bool, matchFn func(Matcher) (Result, error)) (Result, error) {
+	var matched, follow bool
 
 	for _, include := range p {
-		result, err := include.Match(pathname)
+		result, err := matchFn(include)
 
 		switch {
 		case err != nil:
 			return NotMatched, err
 
-		case result == Matched:
+		case result == MatchedAll:
+			return MatchedAll, nil
+
+		// only a directory can be MatchedAll by the remaining matchers
+		case result == Matched && !dir:
 			return Matched, nil
 
+		case result == Matched:
+			matched = true
+
 		case result == Follow:
 			follow = true
 		}
 	}
 
-	if follow {
+	switch {
+	case matched:
+		return Matched, nil
+
+	case follow:
 		return Follow, nil
 	}
 
 	return NotMatched, nil
 }
+
+// CanMatchBelow returns whether any of the matchers can match a path below
+// the directory provided.
+func (p multiMatcher) CanMatchBelow(dir string) bool {
+	for _, include := range p {
+		if canMatchBelow(include, dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p multiMatcher) withoutDotfiles() Matcher {
+	matchers := make(multiMatcher, len(p))
+	for i, include := range p {
+		matchers[i] = withoutDotfiles(include)
+	}
+
+	return matchers
+}
+
+type excludeMatcher struct {
+	include Matcher
+	exclude Matcher
+}
+
+// Exclude returns a new Matcher that matches paths matched by include, unless
+// they're also matched by exclude.
+//
+// An excluded directory is reported as NotMatched, so Glob will not traverse
+// it, even if include could match paths within it. Match still reports those
+// paths as matched, so exclude a directory with a trailing globstar, such as
+// 'vendor/**', for both to agree.
+func Exclude(include, exclude Matcher) Matcher {
+	return excludeMatcher{include: include, exclude: exclude}
+}
+
+// Match returns NotMatched if the path is matched by the exclude matcher,
+// otherwise the result of the include matcher. A directory MatchedAll by the
+// include matcher is only MatchedAll if the exclude matcher returns NotMatched
+// for it.
+func (p excludeMatcher) Match(pathname string) (Result, error) {
+	return p.match(func(m Matcher) (Result, error) {
+		return m.Match(pathname)
+	})
+}
+
+// MatchBytes is the same as Match, but for a path held in a byte slice.
+func (p excludeMatcher) MatchBytes(pathname []byte) (Result, error) {
+	return p.match(func(m Matcher) (Result, error) {
+		return matchBytes(m, pathname)
+	})
+}
+
+func (p excludeMatcher) match(matchFn func(Matcher) (Result, error)) (Result, error) {
+	excluded, err := matchFn(p.exclude)
+
+	switch {
+	case err != nil:
+		return NotMatched, err
+
+	case excluded.Matched():
+		return NotMatched, nil
+	}
+
+	// a directory the exclude matcher returns NotMatched for has nothing
+	// below it that can be excluded
+	result, err := matchFn(p.include)
+	if result == MatchedAll && excluded != NotMatched {
+		return Matched, err
+	}
+
+	return result, err
+}
+
+// CanMatchBelow returns whether the include matcher can match a path below the
+// directory provided, unless everything below it is excluded.
+//
+// Paths are excluded individually, so an excluded directory can still have
+// paths below it matched when a Multi matcher traverses it for another of its
+// matchers. Only a directory the exclude matcher returns MatchedAll for has
+// every path below it excluded.
+func (p excludeMatcher) CanMatchBelow(dir string) bool {
+	if dir != "" {
+		result, err := p.exclude.Match(strings.TrimSuffix(dir, separator) + separator)
+		if err != nil || result == MatchedAll {
+			return false
+		}
+	}
+
+	return canMatchBelow(p.include, dir)
+}
+
+// withoutDotfiles only applies to the include matcher, so hidden paths can
+// still be excluded by wildcards.
+func (p excludeMatcher) withoutDotfiles() Matcher {
+	p.include = withoutDotfiles(p.include)
+
+	return p
+}
@@ -1,10 +1,35 @@
 package matcher
 
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Limiter is the interface used to rate limit I/O performed by Glob. It is
+// satisfied by *rate.Limiter from golang.org/x/time/rate.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
 // GlobOption is an option to configure Glob() behaviour.
 type GlobOption func(*globOptions) error
 
 type globOptions struct {
-	PathTransform func(string) string
+	PathTransform      func(string) string
+	Workers            int
+	MaxConcurrentReads int
+	Limiter            Limiter
+	Stats              *GlobStats
+	ProgressInterval   time.Duration
+	ProgressFn         func(GlobStats)
+	LazyFileInfo       bool
+	Cache              *GlobCache
+	NoHiddenFiles      bool
+
+	// ReadDirFn is called with each directory read
+	ReadDirFn func(dirname string)
 }
 
 // WithPathTransforms allows a function to transform a path prior to it being
@@ -19,11 +44,168 @@ func WithPathTransformer(transformer func(pathname string) string) GlobOption {
 	}
 }
 
+// WithWorkers limits the number of goroutines used to walk the directory
+// tree. By default, the number of CPUs (with a minimum of 4) is used.
+func WithWorkers(n int) GlobOption {
+	return func(o *globOptions) error {
+		if n < 1 {
+			return errors.New("matcher: workers must be at least 1")
+		}
+		o.Workers = n
+		return nil
+	}
+}
+
+// WithMaxConcurrentReads limits the number of directories that can be read
+// at the same time, independently of the number of workers.
+func WithMaxConcurrentReads(n int) GlobOption {
+	return func(o *globOptions) error {
+		if n < 1 {
+			return errors.New("matcher: max concurrent reads must be at least 1")
+		}
+		o.MaxConcurrentReads = n
+		return nil
+	}
+}
+
+// WithRateLimiter sets a Limiter that is waited on before each directory read
+// and each file stat.
+func WithRateLimiter(limiter Limiter) GlobOption {
+	return func(o *globOptions) error {
+		o.Limiter = limiter
+		return nil
+	}
+}
+
+// WithStats fills in the GlobStats provided with statistics about the Glob
+// once it has completed.
+func WithStats(stats *GlobStats) GlobOption {
+	return func(o *globOptions) error {
+		o.Stats = stats
+		return nil
+	}
+}
+
+// WithProgress calls fn with the statistics collected so far every interval,
+// and a final time once the Glob has completed. The function is never called
+// concurrently.
+func WithProgress(interval time.Duration, fn func(stats GlobStats)) GlobOption {
+	return func(o *globOptions) error {
+		if interval <= 0 {
+			return errors.New("matcher: progress interval must be positive")
+		}
+		o.ProgressInterval = interval
+		o.ProgressFn = fn
+		return nil
+	}
+}
+
+// WithLazyFileInfo defers fetching a file's os.FileInfo until it has been
+// matched. On most platforms, this avoids an lstat call for every file and
+// directory encountered that isn't matched.
+func WithLazyFileInfo() GlobOption {
+	return func(o *globOptions) error {
+		o.LazyFileInfo = true
+		return nil
+	}
+}
+
+// WithCache uses the GlobCache provided to avoid reading directories that
+// haven't changed since they were last read.
+func WithCache(cache *GlobCache) GlobOption {
+	return func(o *globOptions) error {
+		o.Cache = cache
+		return nil
+	}
+}
+
+// WithHiddenFiles sets whether Glob considers files and directories beginning
+// with a '.'. By default it does. When disabled, Matchers returned by New, and
+// the include matchers of Multi and Exclude, match as if WithDotfiles(false)
+// was used, so wildcards and globstar don't match hidden paths, but pattern
+// segments explicitly beginning with a '.' do. Other Matchers never match
+// hidden paths, so hidden directories aren't traversed.
+func WithHiddenFiles(enabled bool) GlobOption {
+	return func(o *globOptions) error {
+		o.NoHiddenFiles = !enabled
+		return nil
+	}
+}
+
+// withReadDirs calls fn with each directory read. It's called concurrently.
+func withReadDirs(fn func(dirname string)) GlobOption {
+	return func(o *globOptions) error {
+		o.ReadDirFn = fn
+		return nil
+	}
+}
+
+// WatchOption is an option to configure Watch() behaviour.
+type WatchOption func(*watchOptions) error
+
+type watchOptions struct {
+	PollInterval time.Duration
+	Polling      bool
+	ErrorFn      func(error)
+}
+
+// WithPollInterval sets how often the watched directory is checked for
+// changes when polling. The default is every second.
+func WithPollInterval(interval time.Duration) WatchOption {
+	return func(o *watchOptions) error {
+		if interval <= 0 {
+			return errors.New("matcher: poll interval must be positive")
+		}
+		o.PollInterval = interval
+		return nil
+	}
+}
+
+// WithPolling detects changes by polling, even when file system
+// notifications are available.
+func WithPolling() WatchOption {
+	return func(o *watchOptions) error {
+		o.Polling = true
+		return nil
+	}
+}
+
+// WithWatchErrors calls fn with each error encountered whilst watching, such
+// as the watched directory being removed. Watching continues regardless. The
+// function is never called concurrently.
+func WithWatchErrors(fn func(err error)) WatchOption {
+	return func(o *watchOptions) error {
+		o.ErrorFn = fn
+		return nil
+	}
+}
+
+// GeneralizeOption is an option to configure Generalize() behaviour.
+type GeneralizeOption func(*generalizeOptions)
+
+type generalizeOptions struct {
+	Negatives []string
+}
+
+// WithNegatives provides paths that none of the patterns returned by
+// Generalize may match.
+func WithNegatives(paths ...string) GeneralizeOption {
+	return func(o *generalizeOptions) {
+		o.Negatives = append(o.Negatives, paths...)
+	}
+}
+
 // MatchOption is an option to configure Match() behaviour.
 type MatchOption func(*matchOptions)
 
 type matchOptions struct {
-	MatchFn func(pattern, name string) (matched bool, err error)
+	MatchFn    func(pattern, name string) (matched bool, err error)
+	CaseFold   bool
+	Windows    bool
+	MatchBase  bool
+	Unanchored bool
+	NoDotfiles bool
+	Strict     bool
 }
 
 // WithMatchFunc allows a user provided matcher to be used in place of
@@ -35,3 +217,105 @@ func WithMatchFunc(matcher func(pattern, name string) (matched bool, err error))
 		o.MatchFn = matcher
 	}
 }
+
+// WithCaseFold performs case-insensitive matching by folding the case of both
+// the pattern and path.
+func WithCaseFold() MatchOption {
+	return func(o *matchOptions) {
+		o.CaseFold = true
+	}
+}
+
+// WithWindowsPaths selects Windows path semantics: both '\' and '/' are
+// treated as separators (so '\' can no longer be used to escape), matching is
+// case-insensitive, and the \\?\ and \\?\UNC\ prefixes of extended-length paths
+// are removed, so that they match their regular drive letter and UNC forms.
+//
+// Patterns and paths are only normalized and compared as strings, so this can
+// be used on any platform.
+func WithWindowsPaths() MatchOption {
+	return func(o *matchOptions) {
+		o.Windows = true
+		o.CaseFold = true
+	}
+}
+
+// normalize transforms a pattern or path according to the options.
+func (o *matchOptions) normalize(s string) string {
+	if o.Windows {
+		switch {
+		case strings.HasPrefix(s, `\\?\UNC\`):
+			s = `\\` + s[len(`\\?\UNC\`):]
+		case strings.HasPrefix(s, `\\?\`):
+			s = s[len(`\\?\`):]
+		}
+		s = strings.ReplaceAll(s, `\`, separator)
+	}
+
+	if o.CaseFold {
+		s = strings.ToLower(s)
+	}
+
+	return s
+}
+
+// WithMatchBase matches patterns that don't contain a '/' (other than a
+// trailing one) against the basename of paths at any depth, as if the pattern
+// was prefixed with '**/'. A pattern with a leading '/' is anchored to the
+// root, with the leading '/' removed.
+func WithMatchBase() MatchOption {
+	return func(o *matchOptions) {
+		o.MatchBase = true
+	}
+}
+
+// WithUnanchored matches all patterns at any depth, as if they were prefixed
+// with '**/'. A pattern with a leading '/' is anchored to the root, with the
+// leading '/' removed.
+func WithUnanchored() MatchOption {
+	return func(o *matchOptions) {
+		o.Unanchored = true
+	}
+}
+
+// WithDotfiles sets whether wildcards and globstar match path segments
+// beginning with a '.', such as '.git'. By default they do. When disabled, a
+// hidden path segment is only matched by a pattern segment that explicitly
+// begins with '.', much like shells and most glob tools.
+func WithDotfiles(enabled bool) MatchOption {
+	return func(o *matchOptions) {
+		o.NoDotfiles = !enabled
+	}
+}
+
+// WithStrictFollow only returns Follow for a path when a path below it can
+// be matched, so that a Glob never traverses a directory that cannot lead to
+// a match. By default, Follow is returned for any directory that the pattern
+// hasn't yet been exhausted by, which is cheaper to determine but can be
+// returned when no match is possible, such as 'foo/' for the pattern 'foo//'.
+func WithStrictFollow() MatchOption {
+	return func(o *matchOptions) {
+		o.Strict = true
+	}
+}
+
+// anchor transforms a normalized pattern according to the anchoring options.
+func (o *matchOptions) anchor(pattern string) string {
+	if !o.MatchBase && !o.Unanchored {
+		return pattern
+	}
+
+	if strings.HasPrefix(pattern, separator) {
+		return pattern[1:]
+	}
+
+	if pattern == globstar || strings.HasPrefix(pattern, globstar+separator) {
+		return pattern
+	}
+
+	if o.Unanchored || !strings.Contains(strings.TrimSuffix(pattern, separator), separator) {
+		return globstar + separator + pattern
+	}
+
+	return pattern
+}
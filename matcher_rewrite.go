@@ -0,0 +1,208 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Rewriter rewrites paths matched by a source pattern to the path described
+// by a destination pattern, such as 'src/**/*.scss' to 'dist/**/*.css'.
+type Rewriter struct {
+	matcher matcher
+	dst     [][]term
+}
+
+// termKind is the kind of a pattern term.
+type termKind int
+
+const (
+	termLiteral termKind = iota
+	termStar
+	termQuestion
+	termClass
+	termGlobstar
+)
+
+func (k termKind) String() string {
+	switch k {
+	case termStar:
+		return "'*'"
+	case termQuestion:
+		return "'?'"
+	case termClass:
+		return "character class"
+	case termGlobstar:
+		return "'**'"
+	}
+	return "literal"
+}
+
+// term is a literal or wildcard of a pattern. The capture of a wildcard is
+// the index of the source capture it's replaced with.
+type term struct {
+	kind    termKind
+	literal string
+	capture int
+}
+
+// NewRewriter returns a Rewriter from the source pattern, matched with the
+// options provided, to the destination pattern.
+//
+// Each wildcard of the destination is replaced by what the wildcard of the
+// same kind, in the same order, in the source matched. For example, the first
+// '*' of the destination is replaced with what the first '*' of the source
+// matched, and the second '**' with what the second '**' matched. An error is
+// returned if the destination has more wildcards of a kind than the source,
+// or either pattern is malformed. Rewriting relies on captures, so
+// WithMatchFunc isn't supported.
+func NewRewriter(src, dst string, opts ...MatchOption) (*Rewriter, error) {
+	m := New(src, opts...).(matcher)
+	if m.options.MatchFn != nil {
+		return nil, errors.New("matcher: rewriting is not supported with a custom match function")
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	normalize := m.options
+	normalize.CaseFold = false
+
+	// the captures of the source's wildcards, by kind
+	captures := make(map[termKind][]int)
+	for _, segment := range parseTerms(normalize.normalize(src)) {
+		for _, t := range segment {
+			if t.kind != termLiteral {
+				captures[t.kind] = append(captures[t.kind], t.capture)
+			}
+		}
+	}
+
+	dst = normalize.normalize(dst)
+	for _, segment := range strings.Split(dst, separator) {
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	terms := parseTerms(dst)
+
+	used := make(map[termKind]int)
+	for _, segment := range terms {
+		for i, t := range segment {
+			if t.kind == termLiteral {
+				continue
+			}
+
+			n := used[t.kind]
+			if n >= len(captures[t.kind]) {
+				return nil, fmt.Errorf("matcher: destination has more %v wildcards than source %q", t.kind, src)
+			}
+
+			segment[i].capture = captures[t.kind][n]
+			used[t.kind]++
+		}
+	}
+
+	return &Rewriter{matcher: m, dst: terms}, nil
+}
+
+// Rewrite returns the destination path of a path matched by the source
+// pattern. If the path isn't matched, ok is false. A directory's trailing '/'
+// is kept.
+func (r *Rewriter) Rewrite(pathname string) (rewritten string, ok bool, err error) {
+	_, captures, err := r.matcher.MatchCapture(pathname)
+	if err != nil || captures == nil {
+		return "", false, err
+	}
+
+	segments := make([]string, 0, len(r.dst))
+	for _, segment := range r.dst {
+		var s strings.Builder
+		for _, t := range segment {
+			if t.kind == termLiteral {
+				s.WriteString(t.literal)
+			} else {
+				s.WriteString(captures[t.capture])
+			}
+		}
+
+		// a globstar that matched nothing is removed along with its
+		// separator
+		if len(segment) == 1 && segment[0].kind == termGlobstar && s.Len() == 0 {
+			continue
+		}
+
+		segments = append(segments, s.String())
+	}
+
+	rewritten = strings.Join(segments, separator)
+	if strings.HasSuffix(pathname, separator) && !strings.HasSuffix(rewritten, separator) {
+		rewritten += separator
+	}
+
+	return rewritten, true, nil
+}
+
+// parseTerms splits a normalized pattern into the terms of each segment, with
+// the capture of each wildcard being its index amongst all wildcards, in the
+// same order as MatchCapture.
+func parseTerms(pattern string) [][]term {
+	var (
+		terms    [][]term
+		captures int
+	)
+
+	for _, segment := range strings.Split(pattern, separator) {
+		if segment == globstar {
+			terms = append(terms, []term{{kind: termGlobstar, capture: captures}})
+			captures++
+			continue
+		}
+
+		var (
+			ts  []term
+			lit strings.Builder
+		)
+		add := func(kind termKind, text string) {
+			if lit.Len() > 0 {
+				ts = append(ts, term{kind: termLiteral, literal: lit.String()})
+				lit.Reset()
+			}
+			ts = append(ts, term{kind: kind, literal: text, capture: captures})
+			captures++
+		}
+
+		for i := 0; i < len(segment); i++ {
+			switch segment[i] {
+			case '*':
+				add(termStar, "*")
+
+			case '?':
+				add(termQuestion, "?")
+
+			case '[':
+				n := classLen(segment[i:])
+				add(termClass, segment[i:i+n])
+				i += n - 1
+
+			case '\\':
+				if i+1 < len(segment) {
+					i++
+				}
+				lit.WriteByte(segment[i])
+
+			default:
+				lit.WriteByte(segment[i])
+			}
+		}
+		if lit.Len() > 0 {
+			ts = append(ts, term{kind: termLiteral, literal: lit.String()})
+		}
+
+		terms = append(terms, ts)
+	}
+
+	return terms
+}
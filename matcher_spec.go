@@ -0,0 +1,238 @@
+package matcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// spec is the serialized definition of a Matcher.
+type spec struct {
+	Pattern    *string            `json:"pattern,omitempty"`
+	CaseFold   bool               `json:"caseFold,omitempty"`
+	Windows    bool               `json:"windows,omitempty"`
+	MatchBase  bool               `json:"matchBase,omitempty"`
+	Unanchored bool               `json:"unanchored,omitempty"`
+	Dotfiles   *bool              `json:"dotfiles,omitempty"`
+	Strict     bool               `json:"strict,omitempty"`
+	Any        *[]json.RawMessage `json:"any,omitempty"`
+	Include    json.RawMessage    `json:"include,omitempty"`
+	Exclude    json.RawMessage    `json:"exclude,omitempty"`
+}
+
+// Spec wraps a Matcher so that it can be unmarshaled from its JSON or text
+// definition. A Spec is itself a Matcher.
+//
+// Matchers created by New, Multi and Exclude can be marshaled to, and
+// unmarshaled from, JSON using the following definitions:
+//
+//	{"pattern": "src/**/*.go", "caseFold": true, "windows": true, "matchBase": true, "unanchored": true, "dotfiles": false, "strict": true}
+//	{"any": [<matcher>, ...]}
+//	{"include": <matcher>, "exclude": <matcher>}
+//
+// Option fields are omitted when not enabled. Matchers using WithMatchFunc,
+// or other implementations of Matcher, cannot be marshaled.
+//
+// The text definition of a matcher without options is its pattern, and
+// otherwise its JSON definition.
+type Spec struct {
+	Matcher
+}
+
+// MarshalJSON returns the JSON definition of the matcher.
+func (p matcher) MarshalJSON() ([]byte, error) {
+	if p.options.MatchFn != nil {
+		return nil, errors.New("matcher: matchers using a custom match function cannot be marshaled")
+	}
+
+	var dotfiles *bool
+	if p.options.NoDotfiles {
+		dotfiles = new(bool)
+	}
+
+	return json.Marshal(spec{
+		Pattern:    &p.source,
+		CaseFold:   p.options.CaseFold,
+		Windows:    p.options.Windows,
+		MatchBase:  p.options.MatchBase,
+		Unanchored: p.options.Unanchored,
+		Dotfiles:   dotfiles,
+		Strict:     p.options.Strict,
+	})
+}
+
+// MarshalText returns the pattern of matchers without options, and the JSON
+// definition otherwise.
+func (p matcher) MarshalText() ([]byte, error) {
+	if !p.options.hasOptions() && !isJSON([]byte(p.source)) {
+		return []byte(p.source), nil
+	}
+
+	return p.MarshalJSON()
+}
+
+// MarshalJSON returns the JSON definition of the matcher.
+func (p multiMatcher) MarshalJSON() ([]byte, error) {
+	matchers := make([]json.RawMessage, 0, len(p))
+	for _, m := range p {
+		data, err := marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, data)
+	}
+
+	return json.Marshal(spec{Any: &matchers})
+}
+
+// MarshalText returns the JSON definition of the matcher.
+func (p multiMatcher) MarshalText() ([]byte, error) {
+	return p.MarshalJSON()
+}
+
+// MarshalJSON returns the JSON definition of the matcher.
+func (p excludeMatcher) MarshalJSON() ([]byte, error) {
+	include, err := marshal(p.include)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := marshal(p.exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(spec{Include: include, Exclude: exclude})
+}
+
+// MarshalText returns the JSON definition of the matcher.
+func (p excludeMatcher) MarshalText() ([]byte, error) {
+	return p.MarshalJSON()
+}
+
+// MarshalJSON returns the JSON definition of the wrapped matcher.
+func (s Spec) MarshalJSON() ([]byte, error) {
+	return marshal(s.Matcher)
+}
+
+// MarshalText returns the text definition of the wrapped matcher.
+func (s Spec) MarshalText() ([]byte, error) {
+	if m, ok := s.Matcher.(interface{ MarshalText() ([]byte, error) }); ok {
+		return m.MarshalText()
+	}
+
+	return marshal(s.Matcher)
+}
+
+// UnmarshalJSON reconstructs a matcher from its JSON definition.
+func (s *Spec) UnmarshalJSON(data []byte) error {
+	m, err := unmarshal(data)
+	if err != nil {
+		return err
+	}
+
+	s.Matcher = m
+	return nil
+}
+
+// UnmarshalText reconstructs a matcher from its text definition: either a
+// JSON definition or a pattern.
+func (s *Spec) UnmarshalText(text []byte) error {
+	if isJSON(text) {
+		return s.UnmarshalJSON(text)
+	}
+
+	s.Matcher = New(string(text))
+	return nil
+}
+
+// hasOptions returns whether any serializable options are enabled.
+func (o *matchOptions) hasOptions() bool {
+	return o.CaseFold || o.Windows || o.MatchBase || o.Unanchored || o.NoDotfiles || o.Strict
+}
+
+func isJSON(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+func marshal(m Matcher) ([]byte, error) {
+	if s, ok := m.(Spec); ok {
+		m = s.Matcher
+	}
+	if s, ok := m.(*Spec); ok {
+		m = s.Matcher
+	}
+
+	marshaler, ok := m.(json.Marshaler)
+	if !ok {
+		return nil, fmt.Errorf("matcher: %T cannot be marshaled", m)
+	}
+
+	return marshaler.MarshalJSON()
+}
+
+func unmarshal(data []byte) (Matcher, error) {
+	var s spec
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("matcher: invalid definition: %w", err)
+	}
+
+	switch {
+	case s.Pattern != nil && s.Any == nil && s.Include == nil && s.Exclude == nil:
+		var opts []MatchOption
+		if s.CaseFold {
+			opts = append(opts, WithCaseFold())
+		}
+		if s.Windows {
+			opts = append(opts, WithWindowsPaths())
+		}
+		if s.MatchBase {
+			opts = append(opts, WithMatchBase())
+		}
+		if s.Unanchored {
+			opts = append(opts, WithUnanchored())
+		}
+		if s.Dotfiles != nil {
+			opts = append(opts, WithDotfiles(*s.Dotfiles))
+		}
+		if s.Strict {
+			opts = append(opts, WithStrictFollow())
+		}
+
+		return New(*s.Pattern, opts...), nil
+
+	case s.CaseFold || s.Windows || s.MatchBase || s.Unanchored || s.Dotfiles != nil || s.Strict:
+		return nil, errors.New("matcher: invalid definition: options are only supported with a pattern")
+
+	case s.Pattern == nil && s.Any != nil && s.Include == nil && s.Exclude == nil:
+		matchers := make([]Matcher, 0, len(*s.Any))
+		for _, data := range *s.Any {
+			m, err := unmarshal(data)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, m)
+		}
+
+		return Multi(matchers...), nil
+
+	case s.Pattern == nil && s.Any == nil && s.Include != nil && s.Exclude != nil:
+		include, err := unmarshal(s.Include)
+		if err != nil {
+			return nil, err
+		}
+
+		exclude, err := unmarshal(s.Exclude)
+		if err != nil {
+			return nil, err
+		}
+
+		return Exclude(include, exclude), nil
+	}
+
+	return nil, errors.New("matcher: invalid definition: expected one of pattern, any, or include and exclude")
+}
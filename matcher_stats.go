@@ -0,0 +1,90 @@
+package matcher
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// GlobStats are statistics collected during a Glob.
+type GlobStats struct {
+	// Dirs is the number of directories read.
+	Dirs int64
+
+	// Pruned is the number of directories not traversed because the Matcher
+	// returned NotMatched for them, or nothing below them could be matched.
+	Pruned int64
+
+	// Matched is the number of files and directories matched.
+	Matched int64
+
+	// Errors is the number of permission and I/O errors ignored.
+	Errors int64
+
+	// Elapsed is the time elapsed since the Glob started.
+	Elapsed time.Duration
+}
+
+// globCounters are updated concurrently during a Glob and snapshotted into
+// GlobStats.
+type globCounters struct {
+	dirs    int64
+	pruned  int64
+	matched int64
+	errors  int64
+	start   time.Time
+}
+
+func (c *globCounters) snapshot() GlobStats {
+	return GlobStats{
+		Dirs:    atomic.LoadInt64(&c.dirs),
+		Pruned:  atomic.LoadInt64(&c.pruned),
+		Matched: atomic.LoadInt64(&c.matched),
+		Errors:  atomic.LoadInt64(&c.errors),
+		Elapsed: time.Since(c.start),
+	}
+}
+
+// report calls the progress function, if provided, every interval until the
+// returned function is called. The returned function also fills in the stats
+// requested by WithStats and reports progress a final time.
+func (c *globCounters) report(options *globOptions) func() {
+	finish := func() {
+		stats := c.snapshot()
+		if options.Stats != nil {
+			*options.Stats = stats
+		}
+		if options.ProgressFn != nil {
+			options.ProgressFn(stats)
+		}
+	}
+
+	if options.ProgressFn == nil {
+		return finish
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(options.ProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				options.ProgressFn(c.snapshot())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+
+		finish()
+	}
+}
@@ -0,0 +1,257 @@
+package matcher
+
+// Stepper is implemented by Matchers that can match a path one segment at a
+// time, carrying the State of a directory to its entries, so that walking a
+// tree doesn't require matching the whole path of every entry. Matchers
+// returned by New, Multi and Exclude implement Stepper.
+type Stepper interface {
+	// Root returns the State of the root directory.
+	Root() State
+
+	// Step returns the State of the entry named segment within the directory
+	// of the State provided, and the same result as matching its whole path,
+	// with a trailing '/' if it's a directory.
+	Step(state State, segment string, isDir bool) (State, Result, error)
+}
+
+// State is the state of a Stepper after matching the segments of a path. It
+// is immutable, so the State of a directory can be shared by its entries.
+type State struct {
+	positions positions
+	states    []State
+	path      string
+}
+
+// advancer is implemented by the Steppers in this package, which can step
+// without allocating a State for a file, when it won't be stepped further.
+type advancer interface {
+	advance(state State, segment string, isDir, keep bool) (State, Result, error)
+}
+
+// advance steps a Stepper. Unless keep is set, the State returned for a file
+// may be empty.
+func advance(s Stepper, state State, segment string, isDir, keep bool) (State, Result, error) {
+	if a, ok := s.(advancer); ok {
+		return a.advance(state, segment, isDir, keep)
+	}
+
+	return s.Step(state, segment, isDir)
+}
+
+// asStepper returns the matcher as a Stepper, matching the whole path of each
+// entry if it isn't one.
+func asStepper(m Matcher) Stepper {
+	if s, ok := m.(Stepper); ok {
+		return s
+	}
+
+	return pathStepper{m}
+}
+
+// pathStepper is a Stepper for Matchers that aren't, with the State holding
+// the path so far.
+type pathStepper struct {
+	Matcher
+}
+
+func (m pathStepper) Root() State {
+	return State{}
+}
+
+func (m pathStepper) Step(state State, segment string, isDir bool) (State, Result, error) {
+	pathname := segment
+	if state.path != "" {
+		pathname = state.path + separator + segment
+	}
+
+	next := State{path: pathname}
+	if isDir {
+		pathname += separator
+	}
+
+	result, err := m.Match(pathname)
+
+	return next, result, err
+}
+
+// Root returns the State of the root directory, positioned at the start of
+// the pattern.
+func (p matcher) Root() State {
+	s := make(positions, len(p.pattern)/64+1)
+	p.enter(s, 0)
+
+	return State{positions: s}
+}
+
+// Step advances the positions of the State over a path segment.
+func (p matcher) Step(state State, segment string, isDir bool) (State, Result, error) {
+	return p.advance(state, segment, isDir, true)
+}
+
+func (p matcher) advance(state State, segment string, isDir, keep bool) (State, Result, error) {
+	if p.err != nil {
+		return state, NotMatched, p.err
+	}
+
+	var buf [2][4]uint64
+
+	cur := state.positions
+
+	// normalization can introduce separators, such as with Windows paths
+	i := 0
+	for parts := (segments{path: p.options.normalize(segment)}); !parts.done; i, parts = i+1, parts.next() {
+		next := newPositions(p.pattern, buf[i%2][:])
+		next.reset()
+		if err := p.step(cur, next, parts.first()); err != nil {
+			return state, NotMatched, err
+		}
+		cur = next
+	}
+
+	// the positions are held by the State, which is immutable, so they're
+	// copied from the buffer
+	var next State
+	if isDir || keep {
+		next.positions = append(positions(nil), cur...)
+	}
+
+	if !isDir {
+		switch {
+		case cur.has(len(p.pattern)):
+			return next, Matched, nil
+
+		case p.follow(cur):
+			return next, Follow, nil
+		}
+
+		return next, NotMatched, nil
+	}
+
+	// the directory's trailing separator is stepped over without keeping
+	// the result, as it's not part of the paths below
+	final := newPositions(p.pattern, buf[i%2][:])
+	final.reset()
+	if err := p.step(cur, final, ""); err != nil {
+		return state, NotMatched, err
+	}
+
+	switch {
+	case final.has(len(p.pattern)) && p.all(cur):
+		return next, MatchedAll, nil
+
+	case final.has(len(p.pattern)):
+		return next, Matched, nil
+
+	case p.follow(cur):
+		return next, Follow, nil
+
+	case !p.options.Strict && p.prefix(final):
+		return next, Follow, nil
+	}
+
+	return next, NotMatched, nil
+}
+
+// Root returns the State of the root directory for each matcher.
+func (p multiMatcher) Root() State {
+	states := make([]State, len(p))
+	for i, include := range p {
+		states[i] = asStepper(include).Root()
+	}
+
+	return State{states: states}
+}
+
+// Step steps each matcher, returning the same result as Match. Every matcher
+// is stepped, even once the result is known, so that the State can be
+// stepped further.
+func (p multiMatcher) Step(state State, segment string, isDir bool) (State, Result, error) {
+	return p.advance(state, segment, isDir, true)
+}
+
+func (p multiMatcher) advance(state State, segment string, isDir, keep bool) (State, Result, error) {
+	var next State
+	if isDir || keep {
+		next.states = make([]State, len(p))
+	}
+
+	var (
+		result                Result
+		err                   error
+		done, matched, follow bool
+	)
+	for i, include := range p {
+		s, r, e := advance(asStepper(include), state.states[i], segment, isDir, keep)
+		if next.states != nil {
+			next.states[i] = s
+		}
+
+		switch {
+		case done:
+
+		case e != nil:
+			result, err, done = NotMatched, e, true
+
+		case r == MatchedAll:
+			result, done = MatchedAll, true
+
+		case r == Matched && !isDir:
+			result, done = Matched, true
+
+		case r == Matched:
+			matched = true
+
+		case r == Follow:
+			follow = true
+		}
+	}
+
+	switch {
+	case done:
+	case matched:
+		result = Matched
+	case follow:
+		result = Follow
+	}
+
+	return next, result, err
+}
+
+// Root returns the State of the root directory for the include and exclude
+// matchers.
+func (p excludeMatcher) Root() State {
+	return State{states: []State{asStepper(p.include).Root(), asStepper(p.exclude).Root()}}
+}
+
+// Step steps the include and exclude matchers, returning the same result as
+// Match.
+func (p excludeMatcher) Step(state State, segment string, isDir bool) (State, Result, error) {
+	return p.advance(state, segment, isDir, true)
+}
+
+func (p excludeMatcher) advance(state State, segment string, isDir, keep bool) (State, Result, error) {
+	excludeState, excluded, err := advance(asStepper(p.exclude), state.states[1], segment, isDir, keep)
+	if err != nil {
+		return state, NotMatched, err
+	}
+
+	includeState, result, err := advance(asStepper(p.include), state.states[0], segment, isDir, keep)
+
+	var next State
+	if isDir || keep {
+		next.states = []State{includeState, excludeState}
+	}
+
+	switch {
+	case excluded.Matched():
+		return next, NotMatched, nil
+
+	case err != nil:
+		return next, NotMatched, err
+
+	case result == MatchedAll && excluded != NotMatched:
+		return next, Matched, nil
+	}
+
+	return next, result, nil
+}
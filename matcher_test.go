@@ -1,15 +1,29 @@
 package matcher
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 	// "github.com/bmatcuk/doublestar"
 	// "github.com/saracen/walker"
 )
@@ -131,9 +145,9 @@ var matchTests = map[string][]MatchTest{
 		{"**/bar*", "foo/bar/baz", Follow, nil},
 		{"**/bar/*", "deep/foo/bar/baz", Matched, nil},
 		{"**/bar/*", "deep/foo/bar/baz/", Follow, nil},
-		{"**/bar/**", "deep/foo/bar/baz/", Matched, nil},
+		{"**/bar/**", "deep/foo/bar/baz/", MatchedAll, nil},
 		{"**/bar/*", "deep/foo/bar", Follow, nil},
-		{"**/bar/**", "deep/foo/bar/", Matched, nil},
+		{"**/bar/**", "deep/foo/bar/", MatchedAll, nil},
 		{"**/bar**", "foo/bar/baz", Follow, nil},
 		{"*/bar/**", "foo/bar/baz/x", Matched, nil},
 		{"*/bar/**", "deep/foo/bar/baz/x", NotMatched, nil},
@@ -239,7 +253,7 @@ var matchTests = map[string][]MatchTest{
 		{"abc/def/**/xyz", "abc/def/hello/world", Follow, nil},
 		{"abc/def/**/xyz", "abc/def/hello/world/xyz", Matched, nil},
 		{"**/*", "hello/world", Matched, nil},
-		{"**/abc/**", "hello/world/abc/", Matched, nil},
+		{"**/abc/**", "hello/world/abc/", MatchedAll, nil},
 		{"**/**/**", "hello", Matched, nil},
 		{"**/hello/world", "hello/world", Matched, nil},
 		{"abc/**/hello/world", "abc/hello/world", Matched, nil},
@@ -277,8 +291,8 @@ func TestMatch(t *testing.T) {
 			for _, tt := range tests {
 				matched, err := Match(tt.pattern, tt.s)
 
-				if matched && tt.result != Matched || err != tt.err {
-					t.Errorf("Match(%#q, %#q) = (%v, %v) want (%v, %v)", tt.pattern, tt.s, matched, err, tt.result == Matched, tt.err)
+				if matched && !tt.result.Matched() || err != tt.err {
+					t.Errorf("Match(%#q, %#q) = (%v, %v) want (%v, %v)", tt.pattern, tt.s, matched, err, tt.result.Matched(), tt.err)
 					return
 				}
 			}
@@ -350,6 +364,107 @@ func TestMultiMatcher(t *testing.T) {
 	}
 }
 
+func TestExcludeMatcher(t *testing.T) {
+	tests := map[string]Result{
+		"aaa/bbb/ccc/ddd":     Follow,
+		"aaa/bbb/ccc/ddd/eee": NotMatched,
+		"aaa/zzz/ccc/zzz/eee": Matched,
+		"zzz/":                NotMatched,
+		"zzz/aaa/ccc/eee":     NotMatched,
+	}
+
+	m := Exclude(
+		Multi(New("aaa/**/ccc/**/eee"), New("zzz/**")),
+		Multi(New("aaa/bbb/ccc/ddd/eee"), New("zzz/**")),
+	)
+
+	for path, tt := range tests {
+		result, err := m.Match(path)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if result != tt {
+			t.Errorf("path %q result was %v expected %v", path, result, tt)
+		}
+	}
+}
+
+func TestSpec(t *testing.T) {
+	m := Exclude(
+		Multi(New("src/**/*.go", WithCaseFold()), New("docs/*.md", WithStrictFollow()), New(`C:\*.txt`, WithWindowsPaths())),
+		New("src/vendor/**"),
+	)
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"include":{"any":[{"pattern":"src/**/*.go","caseFold":true},{"pattern":"docs/*.md","strict":true},{"pattern":"C:\\*.txt","caseFold":true,"windows":true}]},"exclude":{"pattern":"src/vendor/**"}}`
+	if string(data) != expected {
+		t.Errorf("marshaled definition was %s expected %s", data, expected)
+	}
+
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	remarshaled, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(remarshaled) != string(data) {
+		t.Errorf("remarshaled definition was %s expected %s", remarshaled, data)
+	}
+
+	for _, pathname := range []string{"SRC/main.go", "src/vendor/x.go", "docs/", "docs/a.md", `c:\a.txt`, "other"} {
+		expected, _ := m.Match(pathname)
+		result, err := spec.Match(pathname)
+		if result != expected || err != nil {
+			t.Errorf("path %q result was (%v, %v) expected (%v, nil)", pathname, result, err, expected)
+		}
+	}
+
+	for text, expected := range map[string]string{
+		"**/*.go":                             "**/*.go",
+		`{"pattern":"*.go"}`:                  "*.go",
+		`{"any":[]}`:                          `{"any":[]}`,
+		`{"pattern":"*.GO","caseFold":true}`:  `{"pattern":"*.GO","caseFold":true}`,
+		`{"pattern":"*.go","matchBase":true}`: `{"pattern":"*.go","matchBase":true}`,
+		`{"pattern":"a/b","unanchored":true}`: `{"pattern":"a/b","unanchored":true}`,
+		`{"pattern":"*","dotfiles":false}`:    `{"pattern":"*","dotfiles":false}`,
+		`{"pattern":"*","dotfiles":true}`:     "*",
+	} {
+		var spec Spec
+		if err := spec.UnmarshalText([]byte(text)); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := spec.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != expected {
+			t.Errorf("text definition of %s was %s expected %s", text, data, expected)
+		}
+	}
+
+	for _, invalid := range []string{`{}`, `{"pattern":"a","any":[]}`, `{"any":[],"caseFold":true}`, `{"include":{"pattern":"a"}}`, `{"unknown":1}`} {
+		var spec Spec
+		if err := json.Unmarshal([]byte(invalid), &spec); err == nil {
+			t.Errorf("definition %s was invalid, but no error was returned", invalid)
+		}
+	}
+
+	if _, err := json.Marshal(New("*", WithMatchFunc(path.Match))); err == nil {
+		t.Errorf("matcher with custom match function was marshaled")
+	}
+}
+
 func TestMatchFunc(t *testing.T) {
 	tests := map[string]Result{
 		"aaa/bbb":              Follow,
@@ -358,40 +473,1652 @@ func TestMatchFunc(t *testing.T) {
 		"aa/zzz/ccc/zzz/eee":   NotMatched,
 	}
 
-	// a custom matcher that uses path.Match, but only succeeds if the path
-	// segment is more than 2 characters.
-	match := func(pattern, name string) (matched bool, err error) {
-		matched, err = path.Match(pattern, name)
-		if matched && len(name) > 2 {
-			return true, err
+	// a custom matcher that uses path.Match, but only succeeds if the path
+	// segment is more than 2 characters.
+	match := func(pattern, name string) (matched bool, err error) {
+		matched, err = path.Match(pattern, name)
+		if matched && len(name) > 2 {
+			return true, err
+		}
+		return false, err
+	}
+
+	for path, tt := range tests {
+		result, err := New("a*/**/ccc/**/eee", WithMatchFunc(match)).Match(path)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if result != tt {
+			t.Errorf("path %q result was %v expected %v", path, result, tt)
+		}
+	}
+}
+
+func TestWindowsPaths(t *testing.T) {
+	tests := []MatchTest{
+		{`src\**\*.cs`, `src\Program.cs`, Matched, nil},
+		{`src\**\*.cs`, `SRC\Foo\Bar.CS`, Matched, nil},
+		{`src\**\*.cs`, `src/foo/bar.cs`, Matched, nil},
+		{`src\**\*.cs`, `src\foo\`, Follow, nil},
+		{`src\**\*.cs`, `lib\foo.cs`, NotMatched, nil},
+		{`C:\Users\*\*.txt`, `c:/users/bob/notes.TXT`, Matched, nil},
+		{`C:\Users\*\*.txt`, `D:\Users\bob\notes.txt`, NotMatched, nil},
+		{`\\?\C:\data\*`, `C:\Data\file`, Matched, nil},
+		{`\\server\share\**`, `\\?\UNC\Server\Share\dir\file`, Matched, nil},
+		{`\\server\share\**`, `\\other\share\file`, NotMatched, nil},
+		{`a\[b]`, `a\b`, Matched, nil},
+	}
+
+	for _, tt := range tests {
+		result, err := New(tt.pattern, WithWindowsPaths()).Match(tt.s)
+		if result != tt.result || err != tt.err {
+			t.Errorf("New(%#q, WithWindowsPaths()).Match(%#q) = (%v, %v) want (%v, %v)", tt.pattern, tt.s, result, err, tt.result, tt.err)
+		}
+	}
+
+	result, err := New("Files/**/*.TXT", WithCaseFold()).Match("files/Dir/FILE.txt")
+	if result != Matched || err != nil {
+		t.Errorf("case-folded match result was (%v, %v) expected (%v, nil)", result, err, Matched)
+	}
+}
+
+func TestAnchoring(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		opt        MatchOption
+		result     Result
+	}{
+		{"*.go", "main.go", WithMatchBase(), Matched},
+		{"*.go", "cmd/matcher/main.go", WithMatchBase(), Matched},
+		{"*.go", "cmd/matcher/", WithMatchBase(), Follow},
+		{"build/", "src/build/", WithMatchBase(), Matched},
+		{"/*.go", "main.go", WithMatchBase(), Matched},
+		{"/*.go", "cmd/main.go", WithMatchBase(), NotMatched},
+		{"/*.go", "cmd/", WithMatchBase(), NotMatched},
+		{"cmd/*.go", "cmd/main.go", WithMatchBase(), Matched},
+		{"cmd/*.go", "src/cmd/main.go", WithMatchBase(), NotMatched},
+		{"cmd/*.go", "src/cmd/main.go", WithUnanchored(), Matched},
+		{"cmd/*.go", "src/", WithUnanchored(), Follow},
+		{"/cmd/*.go", "src/cmd/main.go", WithUnanchored(), NotMatched},
+		{"**/cmd/*.go", "src/cmd/main.go", WithUnanchored(), Matched},
+		{"**", "src/cmd/main.go", WithUnanchored(), Matched},
+	}
+
+	for _, tt := range tests {
+		result, err := New(tt.pattern, tt.opt).Match(tt.s)
+		if result != tt.result || err != nil {
+			t.Errorf("New(%#q).Match(%#q) = (%v, %v) want (%v, nil)", tt.pattern, tt.s, result, err, tt.result)
+		}
+	}
+}
+
+func TestDotfiles(t *testing.T) {
+	tests := []MatchTest{
+		{"*", ".bashrc", NotMatched, nil},
+		{".*", ".bashrc", Matched, nil},
+		{`\.bash*`, ".bashrc", Matched, nil},
+		{"**/*.go", "main.go", Matched, nil},
+		{"**/*.go", ".git/", NotMatched, nil},
+		{"**/*.go", "src/.git/", NotMatched, nil},
+		{"**/*.go", "src/.git/x.go", NotMatched, nil},
+		{"**/*.go", "src/.x.go", NotMatched, nil},
+		{"**/.git/**", "src/.git/", Matched, nil},
+		{"**/.git/*", "src/.git/HEAD", Matched, nil},
+		{"src/**", "src/.git/", NotMatched, nil},
+		{"src/**", "src/a/b", Matched, nil},
+		{".github/**/*.yml", ".github/workflows/ci.yml", Matched, nil},
+	}
+
+	for _, tt := range tests {
+		result, err := New(tt.pattern, WithDotfiles(false)).Match(tt.s)
+		if result != tt.result || err != tt.err {
+			t.Errorf("New(%#q, WithDotfiles(false)).Match(%#q) = (%v, %v) want (%v, %v)", tt.pattern, tt.s, result, err, tt.result, tt.err)
+		}
+	}
+
+	result, err := New("**/*.go", WithDotfiles(true)).Match(".git/x.go")
+	if result != Matched || err != nil {
+		t.Errorf("dotfiles enabled result was (%v, %v) expected (%v, nil)", result, err, Matched)
+	}
+}
+
+func TestStrictFollow(t *testing.T) {
+	tests := []MatchTest{
+		{"foo//", "foo/", NotMatched, nil},
+		{"a/", "a", NotMatched, nil},
+		{"a/", "a/", Matched, nil},
+		{"a/b", "a", Follow, nil},
+		{"a/b", "a/", Follow, nil},
+		{"a/*", "a/b/", NotMatched, nil},
+		{"*/*", "a/", Matched, nil},
+		{"a/*/c", "a/b/", Follow, nil},
+		{"a/**", "a/", MatchedAll, nil},
+		{"**/*.go", "src/", Follow, nil},
+		{"**/*.go", "main.go", Matched, nil},
+	}
+
+	for _, tt := range tests {
+		result, err := New(tt.pattern, WithStrictFollow()).Match(tt.s)
+		if result != tt.result || err != tt.err {
+			t.Errorf("New(%#q, WithStrictFollow()).Match(%#q) = (%v, %v) want (%v, %v)", tt.pattern, tt.s, result, err, tt.result, tt.err)
+		}
+	}
+
+	result, err := New("foo//").Match("foo/")
+	if result != Follow || err != nil {
+		t.Errorf("non-strict result was (%v, %v) expected (%v, nil)", result, err, Follow)
+	}
+}
+
+func TestCanMatchBelow(t *testing.T) {
+	tests := []struct {
+		matcher Matcher
+		dir     string
+		below   bool
+	}{
+		{New("a/b"), "", true},
+		{New("a/b"), "a", true},
+		{New("a/b"), "a/", true},
+		{New("a/b"), "b", false},
+		{New("a/b"), "a/b", false},
+		{New("a/"), "", true},
+		{New("a/"), "a", false},
+		{New("foo//"), "foo", false},
+		{New("**/*.go"), "x/y", true},
+		{New("a/**"), "a", true},
+		{New("["), "", false},
+		{New(`a\b`, WithWindowsPaths()), `A\`, true},
+		{New("*", WithDotfiles(false)), "", true},
+		{Multi(New("a/b"), New("c/**")), "c/d", true},
+		{Multi(New("a/b"), New("c/**")), "a/x", false},
+		{Exclude(New("**"), New("vendor/**")), "vendor", false},
+		{Exclude(New("**"), New("vendor/")), "src", true},
+
+		// paths below an excluded directory aren't themselves excluded
+		{Exclude(New("**"), New("vendor/")), "vendor", true},
+		{Multi(Exclude(New("**"), New("a/")), New("a/")), "a", true},
+	}
+
+	for _, tt := range tests {
+		below := tt.matcher.(DescendantMatcher).CanMatchBelow(tt.dir)
+		if below != tt.below {
+			t.Errorf("%v.CanMatchBelow(%#q) = %v want %v", tt.matcher, tt.dir, below, tt.below)
+		}
+	}
+}
+
+func TestMatchedAll(t *testing.T) {
+	tests := []struct {
+		matcher  Matcher
+		pathname string
+		result   Result
+	}{
+		{New("vendor/**"), "vendor/", MatchedAll},
+		{New("vendor/**"), "vendor/a/", MatchedAll},
+		{New("vendor/**"), "vendor/a", Matched},
+		{New("vendor/**", WithDotfiles(false)), "vendor/", Matched},
+		{New("vendor/**/*.go"), "vendor/", Follow},
+		{Multi(New("*/"), New("vendor/**")), "vendor/", MatchedAll},
+		{Multi(New("*/"), New("vendor/**")), "src/", Matched},
+		{Exclude(New("vendor/**"), New("**/*.md")), "vendor/", Matched},
+		{Exclude(New("vendor/**"), New("src/**")), "vendor/", MatchedAll},
+	}
+
+	for _, tt := range tests {
+		result, err := tt.matcher.Match(tt.pathname)
+		if result != tt.result || err != nil {
+			t.Errorf("%v.Match(%#q) = (%v, %v) want (%v, nil)", tt.matcher, tt.pathname, result, err, tt.result)
+		}
+	}
+
+	for result, matched := range map[Result]bool{NotMatched: false, Matched: true, Follow: false, MatchedAll: true} {
+		if result.Matched() != matched {
+			t.Errorf("%v.Matched() = %v want %v", result, result.Matched(), matched)
+		}
+	}
+}
+
+type recordingMatcher struct {
+	Matcher
+
+	mu    sync.Mutex
+	paths []string
+}
+
+func (m *recordingMatcher) Match(pathname string) (Result, error) {
+	m.mu.Lock()
+	m.paths = append(m.paths, pathname)
+	m.mu.Unlock()
+
+	return m.Matcher.Match(pathname)
+}
+
+func TestGlobMatchedAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "vendor", "a", "b"), 0o777)
+	os.MkdirAll(filepath.Join(dir, "src"), 0o777)
+
+	os.WriteFile(filepath.Join(dir, "vendor", "a", "b", "x.go"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "vendor", "y.go"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "src", "z.go"), []byte{}, 0o600)
+
+	m := &recordingMatcher{Matcher: Multi(New("vendor/**"), New("src/*.go"))}
+
+	matches, err := Glob(context.Background(), dir, m)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, name := range []string{"vendor", "vendor/a", "vendor/a/b", "vendor/a/b/x.go", "vendor/y.go", "src/z.go"} {
+		if _, ok := matches[filepath.Join(dir, name)]; !ok {
+			t.Errorf("%v was expected to be matched", name)
+		}
+	}
+	if len(matches) != 6 {
+		t.Errorf("was expecting 6 matches, got %v", len(matches))
+	}
+
+	for _, pathname := range m.paths {
+		if strings.HasPrefix(pathname, "vendor/") && pathname != "vendor/" {
+			t.Errorf("%v was matched below a directory that was MatchedAll", pathname)
+		}
+	}
+
+	// nothing below src/ can be matched, so it isn't read
+	var stats GlobStats
+	_, err = Glob(context.Background(), dir, New("src/"), WithStats(&stats))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if stats.Dirs != 1 || stats.Pruned != 2 || stats.Matched != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+// stepMatch matches a path by stepping through each of its segments,
+// checking each against the result of matching the path leading to it.
+func stepMatch(t *testing.T, m Matcher, pathname string) {
+	stepper := m.(Stepper)
+	state := stepper.Root()
+
+	parts := strings.Split(strings.TrimSuffix(pathname, "/"), "/")
+	for i, part := range parts {
+		isDir := i < len(parts)-1 || strings.HasSuffix(pathname, "/")
+
+		prefix := strings.Join(parts[:i+1], "/")
+		if isDir {
+			prefix += "/"
+		}
+
+		var result Result
+		var err error
+		state, result, err = stepper.Step(state, part, isDir)
+
+		expected, expectedErr := m.Match(prefix)
+		if result != expected || (err == nil) != (expectedErr == nil) {
+			t.Errorf("stepping %v to %#q = (%v, %v) want (%v, %v)", m, prefix, result, err, expected, expectedErr)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func TestStepper(t *testing.T) {
+	for _, tests := range matchTests {
+		for _, tt := range tests {
+			if tt.s == "" || strings.Contains("/"+strings.TrimSuffix(tt.s, "/")+"/", "//") {
+				continue
+			}
+
+			stepMatch(t, New(tt.pattern), tt.s)
+			stepMatch(t, New(tt.pattern, WithStrictFollow()), tt.s)
+			stepMatch(t, New(tt.pattern, WithDotfiles(false)), tt.s)
+		}
+	}
+
+	matchers := []Matcher{
+		New(`src\**\*.GO`, WithWindowsPaths()),
+		Multi(New("*/"), New("vendor/**"), New("**/*.go")),
+		Multi(New("src/*.go"), &recordingMatcher{Matcher: New("**/*.md")}),
+		Multi(New("vendor/*"), New("[")),
+		Exclude(New("**"), New("vendor/**")),
+		Exclude(New("vendor/**"), New("**/*.md")),
+	}
+	for _, m := range matchers {
+		for _, pathname := range []string{"src/main.go", "src/a/b.go", "vendor/", "vendor/x/y.md", "README.md", ".git/HEAD"} {
+			stepMatch(t, m, pathname)
+		}
+	}
+
+	// files that won't be stepped further, as when globbing, are stepped
+	// without allocating
+	m := Exclude(Multi(New("**/*.go"), New("src/*/dir?/*.txt")), New("vendor/**")).(Stepper)
+	state, _, _ := m.Step(m.Root(), "src", true)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		advance(m, state, "main.go", false, false)
+	})
+	if allocs != 0 {
+		t.Errorf("stepping a file allocated %v times", allocs)
+	}
+}
+
+func TestMatchCapture(t *testing.T) {
+	tests := []struct {
+		matcher  Matcher
+		pathname string
+		result   Result
+		captures []string
+	}{
+		{New("services/*/deploy/**/*.yaml"), "services/api/deploy/eu/prod/app.yaml", Matched, []string{"api", "eu/prod", "app"}},
+		{New("services/*/deploy/**/*.yaml"), "services/api/deploy/app.yaml", Matched, []string{"api", "", "app"}},
+		{New("services/*/deploy/**/*.yaml"), "services/api/", Follow, nil},
+		{New("a?c/[xy]z"), "abc/yz", Matched, []string{"b", "y"}},
+		{New("*.*"), "a.b.c", Matched, []string{"a", "b.c"}},
+		{New("*/*"), "a/", Matched, []string{"a", ""}},
+		{New("vendor/**"), "vendor/x/y/", MatchedAll, []string{"x/y"}},
+		{New("vendor/**"), "vendor/x", Matched, []string{"x"}},
+		{New(`\*/*`), "*/x", Matched, []string{"x"}},
+		{New("[^a]é?"), "bé!", Matched, []string{"b", "!"}},
+		{New("*.go", WithMatchBase()), "a/b/main.go", Matched, []string{"main"}},
+		{New("**/*.go", WithMatchBase()), "a/b/main.go", Matched, []string{"a/b", "main"}},
+		{New("SRC/*.go", WithCaseFold()), "Src/Main.go", Matched, []string{"Main"}},
+		{New(`src\*\*.go`, WithWindowsPaths()), `\\?\src\pkg\Main.go`, Matched, []string{"pkg", "Main"}},
+		{New("**/*", WithDotfiles(false)), "a/.b/c", NotMatched, nil},
+	}
+
+	for _, tt := range tests {
+		result, captures, err := tt.matcher.(CaptureMatcher).MatchCapture(tt.pathname)
+		if result != tt.result || !reflect.DeepEqual(captures, tt.captures) || err != nil {
+			t.Errorf("%v.MatchCapture(%#q) = (%v, %q, %v) want (%v, %q, nil)", tt.matcher, tt.pathname, result, captures, err, tt.result, tt.captures)
+		}
+	}
+
+	if _, _, err := New("[").(CaptureMatcher).MatchCapture("a"); err != ErrBadPattern {
+		t.Errorf("was expecting %v, got %v", ErrBadPattern, err)
+	}
+
+	if _, _, err := New("*", WithMatchFunc(path.Match)).(CaptureMatcher).MatchCapture("a"); err == nil {
+		t.Errorf("was expecting an error for a custom match function")
+	}
+}
+
+func TestRewriter(t *testing.T) {
+	tests := []struct {
+		src, dst  string
+		opts      []MatchOption
+		pathname  string
+		rewritten string
+		ok        bool
+	}{
+		{"src/**/*.scss", "dist/**/*.css", nil, "src/a/b/main.scss", "dist/a/b/main.css", true},
+		{"src/**/*.scss", "dist/**/*.css", nil, "src/main.scss", "dist/main.css", true},
+		{"src/**/*.scss", "dist/**/*.css", nil, "src/main.css", "", false},
+		{"src/**/*.scss", "dist/*.css", nil, "src/a/main.scss", "dist/main.css", true},
+		{"img/*-*.png", "thumbs/*/*.png", nil, "img/cat-small.png", "thumbs/cat/small.png", true},
+		{"v?/[ab]/*", `out/\*?-[xy]/*`, nil, "v1/b/x", "out/*1-b/x", true},
+		{"src/**", "dist/**", nil, "src/a/", "dist/a/", true},
+		{"*.go", "gen/*.pb.go", []MatchOption{WithMatchBase()}, "x/y/api.go", "gen/api.pb.go", true},
+		{"SRC/*.go", "out/*.go", []MatchOption{WithCaseFold()}, "src/Main.go", "out/Main.go", true},
+	}
+
+	for _, tt := range tests {
+		r, err := NewRewriter(tt.src, tt.dst, tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rewritten, ok, err := r.Rewrite(tt.pathname)
+		if rewritten != tt.rewritten || ok != tt.ok || err != nil {
+			t.Errorf("NewRewriter(%#q, %#q).Rewrite(%#q) = (%#q, %v, %v) want (%#q, %v, nil)", tt.src, tt.dst, tt.pathname, rewritten, ok, err, tt.rewritten, tt.ok)
+		}
+	}
+
+	for _, tt := range []struct{ src, dst string }{
+		{"src/*.scss", "dist/**/*.css"},
+		{"src/*.scss", "dist/*/*.css"},
+		{"src/*", "dist/?"},
+		{"[", "dist"},
+		{"src/*", "dist/["},
+	} {
+		if _, err := NewRewriter(tt.src, tt.dst); err == nil {
+			t.Errorf("NewRewriter(%#q, %#q) was expected to return an error", tt.src, tt.dst)
+		}
+	}
+
+	if _, err := NewRewriter("src/*", "dist/*", WithMatchFunc(path.Match)); err == nil {
+		t.Errorf("NewRewriter with a custom match function was expected to return an error")
+	}
+}
+
+func TestToRegexp(t *testing.T) {
+	for _, tests := range matchTests {
+		for _, tt := range tests {
+			re, err := ToRegexp(tt.pattern)
+			if err != nil {
+				if tt.err == nil {
+					t.Errorf("ToRegexp(%#q) returned error %v", tt.pattern, err)
+				}
+				continue
+			}
+
+			result, _ := New(tt.pattern).Match(tt.s)
+			if re.MatchString(tt.s) != result.Matched() {
+				t.Errorf("ToRegexp(%#q) = %v, matching %#q was expected to be %v", tt.pattern, re, tt.s, result.Matched())
+			}
+		}
+	}
+
+	tests := []struct {
+		pattern  string
+		opts     []MatchOption
+		pathname string
+		matched  bool
+	}{
+		{"**/*.go", nil, "a/b/main.go", true},
+		{"**/*.go", nil, "main.go", true},
+		{"**/*.go", nil, "main.go/", false},
+		{"src/**", nil, "src/", true},
+		{"src/**", nil, "src", false},
+		{"*/*", nil, "a/", true},
+		{"[!-0]", nil, "/", false},
+		{"[^a]", nil, "/", false},
+		{"*.go", []MatchOption{WithMatchBase()}, "a/main.go", true},
+		{"*.GO", []MatchOption{WithCaseFold()}, "Main.go", true},
+		{"**/*", []MatchOption{WithDotfiles(false)}, "a/.b", false},
+		{"**/*", []MatchOption{WithDotfiles(false)}, "a/b", true},
+		{"*?", []MatchOption{WithDotfiles(false)}, ".a", false},
+		{"**/.*", []MatchOption{WithDotfiles(false)}, "a/.b", true},
+	}
+
+	for _, tt := range tests {
+		re, err := ToRegexp(tt.pattern, tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if re.MatchString(tt.pathname) != tt.matched {
+			t.Errorf("ToRegexp(%#q) = %v, matching %#q was expected to be %v", tt.pattern, re, tt.pathname, tt.matched)
+		}
+	}
+
+	for _, opts := range [][]MatchOption{
+		{WithWindowsPaths()},
+		{WithMatchFunc(path.Match)},
+	} {
+		if _, err := ToRegexp("*", opts...); !errors.Is(err, ErrUntranslatable) {
+			t.Errorf("was expecting %v, got %v", ErrUntranslatable, err)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		pattern string
+		opts    []MatchOption
+		args    []string
+	}{
+		{"src/*.go", nil, []string{"!", "-type", "d", "-path", "./src/*.go", "!", "-path", "./*/*/*"}},
+		{"src/", nil, []string{"-type", "d", "-path", "./src", "!", "-path", "./*/*"}},
+		{"*/*", nil, []string{"(", "!", "-type", "d", "-path", "./*/*", "!", "-path", "./*/*/*", "-o", "-type", "d", "-path", "./*", "!", "-path", "./*/*", ")"}},
+		{"[^!]", nil, []string{"!", "-type", "d", "-path", "./[!!]", "!", "-path", "./*/*"}},
+		{"*.go", []MatchOption{WithMatchBase()}, []string{"!", "-type", "d", "-name", "*.go"}},
+		{"**/", nil, []string{"-type", "d", "-path", "./*"}},
+		{"vendor/**", nil, []string{"(", "-type", "d", "-path", "./vendor", "-o", "-path", "./vendor/*", ")"}},
+		{"**", nil, []string{"-path", "./*"}},
+		{"SRC/*.GO", []MatchOption{WithCaseFold()}, []string{"!", "-type", "d", "-ipath", "./src/*.go", "!", "-path", "./*/*/*"}},
+		{"src/*", nil, []string{"(", "!", "-type", "d", "-path", "./src/*", "!", "-path", "./*/*/*", "-o", "-type", "d", "-path", "./src", "!", "-path", "./*/*", ")"}},
+		{"**/*.go", nil, []string{"!", "-type", "d", "-name", "*.go"}},
+	}
+
+	for _, tt := range tests {
+		args, err := ToFind(tt.pattern, tt.opts...)
+		if err != nil || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("ToFind(%#q) = (%q, %v) want %q", tt.pattern, args, err, tt.args)
+		}
+	}
+
+	for _, pattern := range []string{"src/**/*.go", "*/**", "**/a/b"} {
+		if _, err := ToFind(pattern); !errors.Is(err, ErrUntranslatable) {
+			t.Errorf("ToFind(%#q) was expected to return %v, got %v", pattern, ErrUntranslatable, err)
+		}
+	}
+
+	matchers := []struct {
+		args     []string
+		pathname string
+		result   Result
+	}{
+		{[]string{"-name", "*.go"}, "a/b/main.go", Matched},
+		{[]string{"-name", "*.go"}, "a/b/main.go/", Matched},
+		{[]string{"-name", "*.go"}, "a/b/main.c", NotMatched},
+		{[]string{"-iname", "*.GO"}, "Main.go", Matched},
+		{[]string{"-name", "*.go", "!", "-path", "./vendor/*"}, "vendor/a/main.go", NotMatched},
+		{[]string{"-name", "*.go", "-a", "-not", "-path", "./vendor/*"}, "src/main.go", Matched},
+		{[]string{"-name", "*.go", "-o", "-name", "*.c"}, "src/main.c", Matched},
+		{[]string{"-path", "./src/*/main.go"}, "src/a/b/main.go", Matched},
+		{[]string{"-path", "./src/*/main.go"}, "src/main.go", NotMatched},
+		{[]string{"-path", "./src/*"}, "src/a/b", Matched},
+		{[]string{"-path", "./src/*"}, "src/", NotMatched},
+		{[]string{"-path", "./src"}, "src/", Matched},
+		{[]string{"-name", "[!a]"}, "b", Matched},
+		{[]string{"-name", "[!a]"}, "a", NotMatched},
+	}
+
+	for _, tt := range matchers {
+		m, err := FromFind(tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result, err := m.Match(tt.pathname); result.Matched() != tt.result.Matched() || err != nil {
+			t.Errorf("FromFind(%q).Match(%#q) = (%v, %v) want (%v, nil)", tt.args, tt.pathname, result, err, tt.result)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-path", "./src/*.go"},
+		{"-path", "src"},
+		{"-type", "f"},
+		{"!", "-name", "*.go"},
+		{"-name", "*.go", "-name", "a*"},
+		{"-name"},
+		{"-name", "["},
+	} {
+		if _, err := FromFind(args); err == nil {
+			t.Errorf("FromFind(%q) was expected to return an error", args)
+		}
+	}
+
+	// the expressions returned by ToFind are parsed by FromFind
+	pathnames := []string{
+		"a", "a/", "a/b", "a/b/", "a/b/c", "a/b/c/", "b", "!", "main.go", "main.go/",
+		"src", "src/", "src/a.go", "src/a.go/", "src/x/", "src/x/b.go", "SRC/A.GO",
+		"vendor", "vendor/", "vendor/x", "vendor/x/", "vendor/x/y",
+	}
+	for _, tt := range tests {
+		m, err := FromFind(tt.args)
+		if err != nil {
+			t.Fatalf("FromFind(ToFind(%#q)) returned %v", tt.pattern, err)
+		}
+
+		for _, pathname := range pathnames {
+			expected, _ := New(tt.pattern, tt.opts...).Match(pathname)
+			if result, err := m.Match(pathname); result.Matched() != expected.Matched() || err != nil {
+				t.Errorf("FromFind(ToFind(%#q)).Match(%#q) = (%v, %v) want %v", tt.pattern, pathname, result, err, expected)
+			}
+		}
+	}
+
+	if m, err := FromFind([]string{"-false"}); err != nil {
+		t.Error(err)
+	} else if result, _ := m.Match("a"); result != NotMatched {
+		t.Errorf("FromFind(-false).Match(a) = %v want NotMatched", result)
+	}
+}
+
+func TestRsync(t *testing.T) {
+	tests := []struct {
+		pattern string
+		opts    []MatchOption
+		rules   []string
+	}{
+		{"src/*.go", nil, []string{"+ /src/*.go"}},
+		{"src/**/*.go", nil, []string{"+ /src/*.go", "+ /src/**/*.go"}},
+		{"*.go", []MatchOption{WithMatchBase()}, []string{"+ /*.go", "+ /**/*.go"}},
+		{"vendor/**", nil, []string{"+ /vendor/***"}},
+		{"a/**/**/b", nil, []string{"+ /a/b", "+ /a/**/b"}},
+		{"*/*", nil, []string{"+ /*/*", "+ /*/"}},
+		{"docs/", nil, []string{"+ /docs/"}},
+		{"[^!]", nil, []string{"+ /[!!]"}},
+	}
+
+	for _, tt := range tests {
+		// every directory is descended into, and everything else excluded
+		tt.rules = append(tt.rules, "+ */", "- *")
+
+		rules, err := ToRsync(tt.pattern, tt.opts...)
+		if err != nil || !reflect.DeepEqual(rules, tt.rules) {
+			t.Errorf("ToRsync(%#q) = (%q, %v) want %q", tt.pattern, rules, err, tt.rules)
+		}
+	}
+
+	for _, opts := range [][]MatchOption{
+		{WithCaseFold()},
+		{WithDotfiles(false)},
+	} {
+		if _, err := ToRsync("*", opts...); !errors.Is(err, ErrUntranslatable) {
+			t.Errorf("was expecting %v, got %v", ErrUntranslatable, err)
+		}
+	}
+
+	matchers := []struct {
+		pattern  string
+		pathname string
+		result   Result
+	}{
+		{"*.go", "a/b/main.go", Matched},
+		{"*.go", "main.go/", Matched},
+		{"/*.go", "a/main.go", NotMatched},
+		{"+ /build/", "build/", Matched},
+		{"/build/", "build", NotMatched},
+		{"/vendor/***", "vendor/", MatchedAll},
+		{"/vendor/***", "vendor/a/b", Matched},
+		{"/vendor/**", "vendor/a/b", Matched},
+		{"/vendor/**", "vendor/", NotMatched},
+		{"/a/**/b", "a/x/y/b", Matched},
+		{"/a/**/b", "a/b", NotMatched},
+		{"a/b", "x/a/b", Matched},
+		{"[!a]", "b", Matched},
+	}
+
+	for _, tt := range matchers {
+		m, err := FromRsync(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result, err := m.Match(tt.pathname); result.Matched() != tt.result.Matched() || err != nil {
+			t.Errorf("FromRsync(%#q).Match(%#q) = (%v, %v) want (%v, nil)", tt.pattern, tt.pathname, result, err, tt.result)
+		}
+	}
+
+	for _, pattern := range []string{"a**b", "/a/***/b", "/a/***/", "[", "- /build/"} {
+		if _, err := FromRsync(pattern); err == nil {
+			t.Errorf("FromRsync(%#q) was expected to return an error", pattern)
+		}
+	}
+}
+
+func TestGeneralize(t *testing.T) {
+	tests := []struct {
+		paths, negatives []string
+		patterns         []string
+	}{
+		{
+			[]string{"src/main.go", "src/util.go"},
+			nil,
+			[]string{"src/*.go"},
+		},
+		{
+			[]string{"src/main.go", "src/a/util.go", "pkg/b.go"},
+			nil,
+			[]string{"**/*.go"},
+		},
+		{
+			[]string{"src/main.go", "src/a/util.go", "pkg/b.go"},
+			[]string{"vendor/x.go"},
+			[]string{"pkg/b.go", "src/**"},
+		},
+		{
+			[]string{"src/main.go", "src/a/util.go", "src/README.md"},
+			[]string{"pkg/b.go"},
+			[]string{"src/**"},
+		},
+		{
+			[]string{"src/main.go", "src/a/util.go"},
+			[]string{"src/a/util_test.go"},
+			[]string{"src/a/util.go", "src/main.go"},
+		},
+		{
+			[]string{"a/Makefile", "b/c/Makefile", "Makefile"},
+			[]string{"a/main.go"},
+			[]string{"**/Makefile"},
+		},
+		{
+			[]string{"build/", "out/[x]/"},
+			[]string{"src/"},
+			[]string{"build/", `out/\[x]/`},
+		},
+		{
+			[]string{"a.go", "b.go"},
+			[]string{"a.go"},
+			[]string{"b.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		patterns := Generalize(tt.paths, WithNegatives(tt.negatives...))
+		if !reflect.DeepEqual(patterns, tt.patterns) {
+			t.Errorf("Generalize(%q, WithNegatives(%q)) = %q want %q", tt.paths, tt.negatives, patterns, tt.patterns)
+		}
+
+		m := make([]Matcher, len(patterns))
+		for i, pattern := range patterns {
+			m[i] = New(pattern)
+		}
+
+		negative := make(map[string]bool)
+		for _, pathname := range tt.negatives {
+			negative[pathname] = true
+		}
+
+		for _, pathname := range tt.paths {
+			if result, _ := Multi(m...).Match(pathname); result.Matched() == negative[pathname] {
+				t.Errorf("Generalize(%q, WithNegatives(%q)).Match(%#q) = %v", tt.paths, tt.negatives, pathname, result)
+			}
+		}
+
+		for _, pathname := range tt.negatives {
+			if result, _ := Multi(m...).Match(pathname); result.Matched() {
+				t.Errorf("Generalize(%q) matched negative path %#q", tt.paths, pathname)
+			}
+		}
+	}
+}
+
+func TestGlobHiddenFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, ".git"), 0o777)
+	os.MkdirAll(filepath.Join(dir, "src"), 0o777)
+
+	os.WriteFile(filepath.Join(dir, ".git", "hook.go"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "src", ".hidden.go"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte{}, 0o600)
+
+	var stats GlobStats
+	matches, err := Glob(context.Background(), dir, New("**/*.go"), WithHiddenFiles(false), WithStats(&stats))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(matches) != 1 || stats.Pruned != 1 {
+		t.Errorf("was expecting 1 file and 1 pruned directory, got %v and %v", len(matches), stats.Pruned)
+	}
+
+	// hidden paths are still matched by pattern segments beginning with a '.'
+	os.MkdirAll(filepath.Join(dir, ".github", "workflows"), 0o777)
+	os.WriteFile(filepath.Join(dir, ".github", "workflows", "ci.yml"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, ".github", ".hidden.yml"), []byte{}, 0o600)
+
+	tests := []struct {
+		matcher  Matcher
+		expected []string
+	}{
+		{New(".github/**"), []string{".github/", ".github/workflows/", ".github/workflows/ci.yml"}},
+		{Multi(New("src/*.go"), New(".github/**/*.yml")), []string{".github/workflows/ci.yml", "src/main.go"}},
+		{Exclude(New("**/.*.go"), New("**/*.tmp")), []string{"src/.hidden.go"}},
+		{matchFunc(func(pathname string) (Result, error) {
+			if strings.HasSuffix(pathname, "/") {
+				return Follow, nil
+			}
+			return Matched, nil
+		}), []string{"src/main.go"}},
+	}
+
+	for _, tc := range tests {
+		matches, err := Glob(context.Background(), dir, tc.matcher, WithHiddenFiles(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var paths []string
+		for pathname, fi := range matches {
+			rel, _ := filepath.Rel(dir, pathname)
+			rel = filepath.ToSlash(rel)
+			if fi.IsDir() {
+				rel += "/"
+			}
+			paths = append(paths, rel)
+		}
+		sort.Strings(paths)
+
+		if !reflect.DeepEqual(paths, tc.expected) {
+			t.Errorf("%v: got %q, expected %q", tc.matcher, paths, tc.expected)
+		}
+	}
+}
+
+func TestGitLabArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"build/app", "build/.hidden", "build/lib/x.o", "build/lib/x.c", "docs/a.md", "docs/b.txt", "out.log", "a.o/inner"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o777)
+		os.WriteFile(filepath.Join(dir, name), []byte{}, 0o600)
+	}
+
+	tests := []struct {
+		paths, exclude []string
+		archived       []string
+	}{
+		{
+			[]string{"build"},
+			nil,
+			[]string{"build/", "build/.hidden", "build/app", "build/lib/", "build/lib/x.c", "build/lib/x.o"},
+		},
+		{
+			[]string{"build/"},
+			[]string{"build/**/*.o"},
+			[]string{"build/", "build/.hidden", "build/app", "build/lib/", "build/lib/x.c"},
+		},
+		{
+			// excluding a directory doesn't exclude its contents
+			[]string{"build"},
+			[]string{"build/lib"},
+			[]string{"build/", "build/.hidden", "build/app", "build/lib/x.c", "build/lib/x.o"},
+		},
+		{
+			[]string{"build"},
+			[]string{"build/lib/**"},
+			[]string{"build/", "build/.hidden", "build/app"},
+		},
+		{
+			[]string{"**/*.o"},
+			nil,
+			[]string{"a.o/", "a.o/inner", "build/lib/x.o"},
+		},
+		{
+			[]string{"*/*"},
+			[]string{"**/*.txt"},
+			[]string{"a.o/inner", "build/.hidden", "build/app", "build/lib/", "build/lib/x.c", "build/lib/x.o", "docs/a.md"},
+		},
+		{
+			[]string{"docs/*.md", "../docs/b.txt", "./docs/../out.log", filepath.Join(dir, "a.o")},
+			nil,
+			[]string{"a.o/", "a.o/inner", "docs/a.md", "out.log"},
+		},
+		{
+			[]string{"."},
+			[]string{"**/*.o/**", "build/**", "docs"},
+			[]string{"docs/a.md", "docs/b.txt", "out.log"},
+		},
+		{
+			[]string{"../"},
+			nil,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		archived, err := GitLabArtifacts(context.Background(), dir, tt.paths, tt.exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(archived, tt.archived) {
+			t.Errorf("GitLabArtifacts(%q, %q) = %q want %q", tt.paths, tt.exclude, archived, tt.archived)
+		}
+	}
+
+	if _, err := GitLabArtifacts(context.Background(), dir, []string{"["}, nil); err != ErrBadPattern {
+		t.Errorf("was expecting %v, got %v", ErrBadPattern, err)
+	}
+}
+
+func TestGitHubFilter(t *testing.T) {
+	// from GitHub's filter pattern cheat sheet
+	tests := []struct {
+		patterns            []string
+		matched, notMatched []string
+	}{
+		{[]string{"*"}, []string{"README.md", "server.rb"}, []string{"docs/README.md"}},
+		{[]string{"*.jsx?"}, []string{"page.js", "page.jsx"}, []string{"page.jsxx", "src/page.js"}},
+		{[]string{"**"}, []string{"all/the/files.md", ".github/workflows/ci.yml"}, nil},
+		{[]string{"*.js"}, []string{"app.js", "index.js"}, []string{"js/index.js"}},
+		{[]string{"**.js"}, []string{"index.js", "js/index.js", "src/js/app.js"}, []string{"index.jsx"}},
+		{[]string{"docs/*"}, []string{"docs/README.md", "docs/file.txt"}, []string{"docs/a/file.txt"}},
+		{[]string{"docs/**"}, []string{"docs/README.md", "docs/mona/octocat.txt"}, []string{"README.md"}},
+		{[]string{"docs/**/*.md"}, []string{"docs/README.md", "docs/mona/hello-world.md", "docs/a/markdown/already.md"}, []string{"docs/a.txt"}},
+		{[]string{"**/docs/**"}, []string{"docs/hello.md", "dir/docs/my-file.txt", "space/docs/plan/space.doc"}, []string{"mydocs/a.md"}},
+		{[]string{"**/README.md"}, []string{"README.md", "js/README.md"}, []string{"README.markdown"}},
+		{[]string{"**/*src/**"}, []string{"a/src/app.js", "my-src/code/js/app.js"}, []string{"source/app.js"}},
+		{[]string{"**/*-post.md"}, []string{"my-post.md", "path/their-post.md"}, []string{"post.md"}},
+		{[]string{"**/migrate-*.sql"}, []string{"migrate-10909.sql", "db/migrate-v1.0.sql", "db/sept/migrate-v1.sql"}, nil},
+		{[]string{"*.md", "!README.md"}, []string{"hello.md"}, []string{"README.md", "docs/hello.md"}},
+		{[]string{"*.md", "!README.md", "README*"}, []string{"hello.md", "README.md", "README.doc"}, nil},
+		{[]string{"ba+r", "v[0-9]/**"}, []string{"bar", "baaar", "v1/x"}, []string{"br", "va/x"}},
+		{[]string{`\*.md`, "src**test"}, []string{"*.md", "srctest", "src/a/test"}, []string{"a.md"}},
+		{[]string{"né+t", "[à-é]?x"}, []string{"nét", "néét", "éx", "x"}, []string{"nt", "n\xc3\xa9\xa9t", "ñx"}},
+	}
+
+	for _, tt := range tests {
+		f, err := NewGitHubFilter(tt.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, pathname := range tt.matched {
+			if result, err := f.Match(pathname); result != Matched || err != nil {
+				t.Errorf("NewGitHubFilter(%q).Match(%#q) = (%v, %v) want Matched", tt.patterns, pathname, result, err)
+			}
+		}
+		for _, pathname := range tt.notMatched {
+			if result, err := f.Match(pathname); result != NotMatched || err != nil {
+				t.Errorf("NewGitHubFilter(%q).Match(%#q) = (%v, %v) want NotMatched", tt.patterns, pathname, result, err)
+			}
+		}
+	}
+
+	f, err := NewGitHubFilter([]string{"docs/**", "!docs/**", "docs/a/*.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, _ := f.Match("docs/a/"); result != Follow {
+		t.Errorf("was expecting Follow for a directory a later pattern matches below, got %v", result)
+	}
+	if any, _ := f.AnyMatch([]string{"README.md", "docs/a/x.md"}); !any {
+		t.Errorf("was expecting a changed path to match")
+	}
+	if all, _ := f.AllMatch([]string{"README.md", "docs/a/x.md"}); all {
+		t.Errorf("wasn't expecting all changed paths to match")
+	}
+
+	// each '**' within a segment doubles the patterns matched
+	if _, err := NewGitHubFilter([]string{strings.Repeat("a**", 8)}); err != nil {
+		t.Errorf("was expecting a pattern with 8 '**' within a segment, got %v", err)
+	}
+
+	for _, patterns := range [][]string{{"!"}, {"[]"}, {"a/[z-a]"}, {`a\`}, {strings.Repeat("a**/", 9)}} {
+		if _, err := NewGitHubFilter(patterns); err == nil {
+			t.Errorf("NewGitHubFilter(%q) was expected to return an error", patterns)
+		}
+	}
+}
+
+func TestDockerIgnore(t *testing.T) {
+	// from Docker's pattern matcher tests
+	tests := []struct {
+		pattern, pathname string
+		ignored           bool
+	}{
+		{"**", "file", true},
+		{"**", "file/", true},
+		{"**/", "file", true},
+		{"**/", "dir/file", true},
+		{"**/file", "file", true},
+		{"**/file", "dir/file", true},
+		{"**/file", "dir/dir/file", true},
+		{"**/file*", "dir/dir/file.txt", true},
+		{"**/file*txt", "dir/dir/file.txt", true},
+		{"**/file*.txt", "file.txt", true},
+		{"**/**/*.txt", "file.txt", true},
+		{"**/**/*.txt2", "file.txt", false},
+		{"**/*.txt", "file.txt", true},
+		{"**/**/*.txt", "dir/file.txt", true},
+		{"dir/**", "dir/file", true},
+		{"dir/**", "dir/dir2/file", true},
+		{"**/dir2/*", "dir/dir2/file", true},
+		{"**/dir2/**", "dir/dir2/dir3/file", true},
+		{"**file", "file", true},
+		{"**file", "dir/file", true},
+		{"**file", "dir/dir/file", true},
+		{"**/dir/**", "dir/file", true},
+		{"**/dir/**", "dir/dir/file", true},
+		{"dir/**/file", "dir/file", true},
+		{"dir/**/file", "dir/dir/file", true},
+		{"dir**/file", "dir/file", true},
+		{"dir**/file", "dirs/dir/file", true},
+		{"a[b-d]e", "ace", true},
+		{"a[b-d]e", "aze", false},
+		{"abc.def", "abcdef", false},
+		{"abc.def", "abc.def", true},
+		{"abc?def", "abcZdef", true},
+		{"abc?def", "abcdef", false},
+		{"**/foo/bar", "foo/bar", true},
+		{"**/foo/bar", "dir/foo/bar", true},
+		{"abc/**", "abc", false},
+		{"abc/**", "abc/def", true},
+		{"**/.foo", ".foo", true},
+		{"**/.foo", "bar.foo", false},
+		{"a(b)c/def", "a(b)c/def", true},
+		{"a.|)$(}+{bc", "a.|)$(}+{bc", true},
+		{"dist/proxy.py-2.4.0rc3.dev36+g08acad9-py3-none-any.whl", "dist/proxy.py-2.4.0rc3.dev36+g08acad9-py3-none-any.whl", true},
+		{"/docs", "docs/a.md", true},
+		{"docs/../build", "build/out", true},
+	}
+
+	for _, tt := range tests {
+		d, err := ParseDockerIgnore(strings.NewReader(tt.pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ignored := d.Ignored(tt.pathname); ignored != tt.ignored {
+			t.Errorf("%#q: Ignored(%#q) = %v want %v", tt.pattern, tt.pathname, ignored, tt.ignored)
+		}
+	}
+
+	d, err := ParseDockerIgnore(strings.NewReader("\xEF\xBB\xBF# comment\n*.md\n!README.md\n  vendor  \n!vendor/keep/\nbuild\n!**/build/app\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []struct {
+		pathname string
+		result   Result
+	}{
+		{"a.md", NotMatched},
+		{"README.md", Matched},
+		{"docs/a.md", Matched},
+		{"# comment", Matched},
+		{"vendor/", Follow},
+		{"vendor/x", NotMatched},
+		{"vendor/keep/", Matched},
+		{"vendor/keep/x", Matched},
+		{"vendor/other/", NotMatched},
+		{"build/", NotMatched},
+		{"build/app", Matched},
+	}
+
+	for _, tt := range results {
+		if result, err := d.Match(tt.pathname); result != tt.result || err != nil {
+			t.Errorf("Match(%#q) = (%v, %v) want %v", tt.pathname, result, err, tt.result)
+		}
+	}
+
+	for _, patterns := range [][]string{{"!"}, {"["}, {"!a/["}} {
+		if _, err := NewDockerIgnore(patterns); err == nil {
+			t.Errorf("NewDockerIgnore(%q) was expected to return an error", patterns)
+		}
+	}
+}
+
+func TestDockerContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"Dockerfile", "README.md", "notes.md", "src/main.go", "src/main_test.go", "vendor/a/x.go", "vendor/keep/y.go", ".git/HEAD"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o777)
+		os.WriteFile(filepath.Join(dir, name), []byte{}, 0o600)
+	}
+
+	d, err := NewDockerIgnore([]string{".git", "*.md", "!README.md", "**/*_test.go", "vendor", "!vendor/keep"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := DockerContext(context.Background(), dir, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"Dockerfile", "README.md", "src/", "src/main.go", "vendor/keep/", "vendor/keep/y.go"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("DockerContext() = %q want %q", paths, expected)
+	}
+}
+
+func TestEditorConfigSection(t *testing.T) {
+	// from the EditorConfig core glob tests
+	tests := []struct {
+		glob                string
+		matched, notMatched []string
+	}{
+		{"a*e.c", []string{"ace.c", "abcde.c", "ae.c", "dir/ace.c"}, []string{"a/e.c"}},
+		{"Bar/*", []string{"Bar/foo.txt"}, []string{"Bar/a/foo.txt", "x/Bar/foo.txt"}},
+		{"/Bar/*", []string{"Bar/foo.txt"}, []string{"x/Bar/foo.txt"}},
+		{"a**z.c", []string{"a/z.c", "amnz.c", "am/nz.c", "a/mnz.c", "amn/z.c"}, []string{"a/b.c"}},
+		{"**.txt", []string{"a.txt", "x/y/a.txt"}, []string{"a.md"}},
+		{"a/**/z.c", []string{"a/z.c", "a/b/z.c", "a/b/c/z.c"}, []string{"b/z.c"}},
+		{"ab?def.c", []string{"abcdef.c"}, []string{"ab/def.c", "abdef.c"}},
+		{"[ab].a", []string{"a.a", "b.a"}, []string{"c.a"}},
+		{"[!ab].b", []string{"c.b"}, []string{"a.b", "/.b"}},
+		{"[d-g].c", []string{"f.c"}, []string{"h.c"}},
+		{"[]x", []string{"[]x"}, []string{"x"}},
+		{"*.{py,js}", []string{"a.py", "b/a.js"}, []string{"a.pyjs", "a.{py,js}"}},
+		{"{single}.b", []string{"{single}.b"}, []string{"single.b"}},
+		{"{}.c", []string{"{}.c"}, []string{".c"}},
+		{"{word,{also},this}.g", []string{"word.g", "{also}.g", "this.g"}, []string{"also.g"}},
+		{"{,a}.e", []string{".e", "a.e"}, []string{"b.e"}},
+		{"{a,b/c}.f", []string{"a.f", "b/c.f"}, []string{"x/a.f"}},
+		{"{3..120}", []string{"3", "15", "120"}, []string{"1", "121", "a3"}},
+		{"{-3..3}.h", []string{"-3.h", "0.h", "+3.h"}, []string{"-4.h"}},
+		{"{aardvark..antelope}", []string{"{aardvark..antelope}"}, []string{"aardvark"}},
+		{`\*.i`, []string{"*.i"}, []string{"a.i"}},
+	}
+
+	for _, tt := range tests {
+		m, err := NewEditorConfigSection(tt.glob)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, pathname := range tt.matched {
+			if result, err := m.Match(pathname); !result.Matched() || err != nil {
+				t.Errorf("NewEditorConfigSection(%#q).Match(%#q) = (%v, %v) want Matched", tt.glob, pathname, result, err)
+			}
+		}
+		for _, pathname := range tt.notMatched {
+			if result, err := m.Match(pathname); result.Matched() || err != nil {
+				t.Errorf("NewEditorConfigSection(%#q).Match(%#q) = (%v, %v) want NotMatched", tt.glob, pathname, result, err)
+			}
+		}
+	}
+
+	if _, err := NewEditorConfigSection("[z-a]"); err == nil {
+		t.Errorf("was expecting an error for an invalid range")
+	}
+	if _, err := NewEditorConfigSection(strings.Repeat("a**", 9)); err == nil {
+		t.Errorf("was expecting an error for too many '**' within segments")
+	}
+}
+
+func TestResolveEditorConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		// above the root, so never read
+		".editorconfig": "[*]\nignored = true\n",
+
+		"project/.editorconfig": `
+; comment
+root = true
+
+[*]
+indent_style = Space
+indent_size = 4
+Custom = Value
+
+[*.go]
+indent_style = tab
+`,
+
+		"project/pkg/.editorconfig": `
+[*.go]
+tab_width = 8
+
+[Makefile]
+indent_style = tab
+
+[/only/*.txt]
+charset = utf-8
+invalid line
+`,
+	}
+	for name, contents := range files {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o777)
+		os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600)
+	}
+
+	tests := []struct {
+		filename   string
+		properties []EditorConfigProperty
+	}{
+		{
+			"project/README.md",
+			[]EditorConfigProperty{{"indent_style", "space"}, {"indent_size", "4"}, {"custom", "Value"}, {"tab_width", "4"}},
+		},
+		{
+			"project/main.go",
+			[]EditorConfigProperty{{"indent_size", "4"}, {"custom", "Value"}, {"indent_style", "tab"}, {"tab_width", "4"}},
+		},
+		{
+			"project/pkg/x/Makefile",
+			[]EditorConfigProperty{{"indent_size", "4"}, {"custom", "Value"}, {"indent_style", "tab"}, {"tab_width", "4"}},
+		},
+		{
+			"project/pkg/only/a.txt",
+			[]EditorConfigProperty{{"indent_style", "space"}, {"indent_size", "4"}, {"custom", "Value"}, {"charset", "utf-8"}, {"tab_width", "4"}},
+		},
+		{
+			"project/pkg/x/only/a.txt",
+			[]EditorConfigProperty{{"indent_style", "space"}, {"indent_size", "4"}, {"custom", "Value"}, {"tab_width", "4"}},
+		},
+	}
+
+	for _, tt := range tests {
+		properties, err := ResolveEditorConfig(filepath.Join(dir, tt.filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(properties, tt.properties) {
+			t.Errorf("ResolveEditorConfig(%#q) = %v want %v", tt.filename, properties, tt.properties)
+		}
+	}
+
+	config, err := ParseEditorConfig(strings.NewReader("[*]\nindent_style = tab\ntab_width = 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Root || len(config.Sections) != 1 || len(config.Sections[0].Properties) != 2 {
+		t.Errorf("ParseEditorConfig() = %+v", config)
+	}
+
+	// a section with an invalid glob is skipped, along with its properties
+	config, err = ParseEditorConfig(strings.NewReader("[*]\nindent_style = tab\n[[z-a]]\nroot = true\nindent_size = 4\n[*.md]\ntab_width = 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []EditorConfigSection{
+		{Glob: "*", Properties: []EditorConfigProperty{{"indent_style", "tab"}}},
+		{Glob: "*.md", Properties: []EditorConfigProperty{{"tab_width", "2"}}},
+	}
+	if config.Root || len(config.Sections) != len(expected) {
+		t.Fatalf("ParseEditorConfig() = %+v", config)
+	}
+	for i, section := range config.Sections {
+		if section.Glob != expected[i].Glob || !reflect.DeepEqual(section.Properties, expected[i].Properties) {
+			t.Errorf("section %d = %+v want %+v", i, section, expected[i])
+		}
+	}
+	if result, err := config.Sections[1].Match("docs/a.md"); !result.Matched() || err != nil {
+		t.Errorf("Match(%#q) = (%v, %v) want Matched", "docs/a.md", result, err)
+	}
+}
+
+func TestMultiMatcherInvalid(t *testing.T) {
+	_, err := Multi(
+		New("abc"),
+		New("[]a]"),
+	).Match("abcdef")
+
+	if err == nil {
+		t.Errorf("include pattern was invalid, but not error was returned")
+	}
+}
+
+func TestNewMatcherInvalid(t *testing.T) {
+	// a malformed pattern is an error even when the malformed segment isn't
+	// reached, as with path.Match
+	tests := []struct {
+		pattern, s string
+	}{
+		{"a/[", "b"},
+		{"a/[", "a/"},
+		{"[/a", "b"},
+		{`x/\`, ""},
+		{"**/a[", "b/c"},
+	}
+
+	for _, tt := range tests {
+		m := New(tt.pattern)
+
+		result, err := m.Match(tt.s)
+		if result != NotMatched || err != ErrBadPattern {
+			t.Errorf("New(%#q).Match(%#q) = (%v, %v) want (NotMatched, %v)", tt.pattern, tt.s, result, err, ErrBadPattern)
+		}
+
+		if m.(DescendantMatcher).CanMatchBelow("") {
+			t.Errorf("New(%#q).CanMatchBelow(\"\") = true want false", tt.pattern)
+		}
+	}
+
+	// a match function is responsible for its own errors
+	m := New("a/[", WithMatchFunc(func(pattern, name string) (bool, error) {
+		return pattern == name, nil
+	}))
+	if result, err := m.Match("b"); result != NotMatched || err != nil {
+		t.Errorf("New with a match function returned (%v, %v) want (NotMatched, nil)", result, err)
+	}
+}
+
+func TestGlobExcludeMulti(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "a"), 0o777)
+	os.WriteFile(filepath.Join(dir, "a", "x.txt"), []byte{}, 0o600)
+
+	// the directory excluded is matched by another matcher, so it's
+	// traversed and the file below, which isn't excluded, is matched
+	m := Multi(Exclude(New("**"), New("a/")), New("a/"))
+	if result, err := m.Match("a/x.txt"); result != Matched || err != nil {
+		t.Errorf("Match(%#q) = (%v, %v) want (Matched, nil)", "a/x.txt", result, err)
+	}
+
+	matches, err := Glob(context.Background(), dir, m)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, name := range []string{"a", "a/x.txt"} {
+		if _, ok := matches[filepath.Join(dir, name)]; !ok {
+			t.Errorf("%v was expected to be matched", name)
+		}
+	}
+
+	// without another matcher, the excluded directory isn't traversed, even
+	// though Match reports the file below as matched, unless the exclude
+	// pattern has a trailing globstar
+	for _, exclude := range []string{"a/", "a/**"} {
+		m := Exclude(New("**"), New(exclude))
+		result, _ := m.Match("a/x.txt")
+		if result.Matched() != (exclude == "a/") {
+			t.Errorf("Exclude(%#q).Match(%#q) = %v", exclude, "a/x.txt", result)
+		}
+
+		matches, err := Glob(context.Background(), dir, m)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(matches) != 0 {
+			t.Errorf("Exclude(%#q) was expecting no matches, got %v", exclude, len(matches))
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "files", "dir1"), 0o777)
+	os.MkdirAll(filepath.Join(dir, "files", "dir2"), 0o777)
+	os.MkdirAll(filepath.Join(dir, "files", "dir3"), 0o111)
+	os.MkdirAll(filepath.Join(dir, "ignore", "dir4"), 0o777)
+
+	os.WriteFile(filepath.Join(dir, "files", "dir1", "file1.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "dir1", "file2.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "dir2", "file3.ignore"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "dir3", "file4.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "ignore", "dir4", "file5.txt"), []byte{}, 0o600)
+
+	matches, err := Glob(context.Background(), dir, New("files/**/*.txt"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(matches) != 2 {
+		t.Errorf("was expecting 2 files, got %v", len(matches))
+	}
+}
+
+func TestGlobMultiMatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "files", "dir1"), 0o777)
+	os.MkdirAll(filepath.Join(dir, "files", "dir2"), 0o777)
+
+	os.WriteFile(filepath.Join(dir, "files", "dir1", "File1.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "dir1", "File2.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "dir2", "File3.txt"), []byte{}, 0o600)
+
+	matches, err := Glob(context.Background(), dir, Multi(
+		New(strings.ToLower("files/DIR1/file1.txt")),
+		New(strings.ToLower("files/DIR1/file2.txt")),
+	), WithPathTransformer(strings.ToLower))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(matches) != 2 {
+		t.Errorf("was expecting 2 files, got %v", len(matches))
+	}
+}
+
+var archiveEntries = []string{"./", "./release/", "./release/app", "./release/certs/", "./release/certs/server.pem", "/release/.env", "release/docs/readme.md"}
+
+func TestMatchTar(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		var buf bytes.Buffer
+
+		var w io.WriteCloser = nopWriteCloser{&buf}
+		if compressed {
+			w = gzip.NewWriter(&buf)
+		}
+
+		tw := tar.NewWriter(w)
+		for _, name := range archiveEntries {
+			hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o600}
+			if strings.HasSuffix(name, "/") {
+				hdr.Typeflag = tar.TypeDir
+			}
+			tw.WriteHeader(hdr)
+		}
+		tw.Close()
+		w.Close()
+
+		matches, err := MatchTar(&buf, Multi(New("**/*.pem"), New("**/.env"), New("**/certs/")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, hdr := range matches {
+			names = append(names, hdr.Name)
+		}
+
+		expected := []string{"./release/certs/", "./release/certs/server.pem", "/release/.env"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("compressed: %v, matches were %v expected %v", compressed, names, expected)
+		}
+	}
+}
+
+func TestMatchZip(t *testing.T) {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	for _, name := range archiveEntries {
+		zw.Create(name)
+	}
+	zw.Close()
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := MatchZip(zr, Multi(New("**/*.pem"), New("release/*/")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range matches {
+		names = append(names, f.Name)
+	}
+
+	expected := []string{"./release/certs/", "./release/certs/server.pem"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("matches were %v expected %v", names, expected)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+type countingLimiter struct {
+	waits int64
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	atomic.AddInt64(&l.waits, 1)
+	return ctx.Err()
+}
+
+func TestGlobConcurrencyOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "files", "dir1"), 0o777)
+	os.MkdirAll(filepath.Join(dir, "files", "dir2"), 0o777)
+
+	os.WriteFile(filepath.Join(dir, "files", "dir1", "file1.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "dir2", "file2.txt"), []byte{}, 0o600)
+
+	limiter := &countingLimiter{}
+	matches, err := Glob(context.Background(), dir, New("files/**/*.txt"),
+		WithWorkers(1),
+		WithMaxConcurrentReads(1),
+		WithRateLimiter(limiter))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(matches) != 2 {
+		t.Errorf("was expecting 2 files, got %v", len(matches))
+	}
+
+	// 4 directory reads and 5 stats
+	if limiter.waits != 9 {
+		t.Errorf("was expecting 9 limiter waits, got %v", limiter.waits)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = Glob(ctx, dir, New("files/**/*.txt"), WithRateLimiter(limiter))
+	if err != context.Canceled {
+		t.Errorf("was expecting context.Canceled, got %v", err)
+	}
+
+	_, err = Glob(context.Background(), dir, New("**"), WithWorkers(0))
+	if err == nil {
+		t.Errorf("was expecting an error for invalid worker count")
+	}
+}
+
+// matchFunc is a Matcher calling a function for each path matched.
+type matchFunc func(pathname string) (Result, error)
+
+func (fn matchFunc) Match(pathname string) (Result, error) {
+	return fn(pathname)
+}
+
+func TestGlobWorkers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 4; j++ {
+			os.MkdirAll(filepath.Join(dir, strconv.Itoa(i), strconv.Itoa(j)), 0o777)
+			os.WriteFile(filepath.Join(dir, strconv.Itoa(i), strconv.Itoa(j), "file.txt"), []byte{}, 0o600)
 		}
-		return false, err
 	}
 
-	for path, tt := range tests {
-		result, err := New("a*/**/ccc/**/eee", WithMatchFunc(match)).Match(path)
+	for _, workers := range []int{1, 2, 4} {
+		var active, most int32
+
+		// the matcher is called from each goroutine walking the tree, so
+		// the number of calls in progress is bounded by the workers
+		m := matchFunc(func(pathname string) (Result, error) {
+			n := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+
+			for {
+				current := atomic.LoadInt32(&most)
+				if n <= current || atomic.CompareAndSwapInt32(&most, current, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+
+			return Matched, nil
+		})
+
+		matches, err := Glob(context.Background(), dir, m, WithWorkers(workers))
 		if err != nil {
 			t.Error(err)
 		}
 
-		if result != tt {
-			t.Errorf("path %q result was %v expected %v", path, result, tt)
+		if len(matches) != 72 {
+			t.Errorf("was expecting 72 matches, got %v", len(matches))
+		}
+
+		if most > int32(workers) {
+			t.Errorf("was expecting at most %v concurrent matches, got %v", workers, most)
 		}
 	}
 }
 
-func TestMultiMatcherInvalid(t *testing.T) {
-	_, err := Multi(
-		New("abc"),
-		New("[]a]"),
-	).Match("abcdef")
+func TestGlobIgnorableErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+	}
 
-	if err == nil {
-		t.Errorf("include pattern was invalid, but not error was returned")
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "files", "removed"), 0o777)
+	os.WriteFile(filepath.Join(dir, "files", "file1.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "file2.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "removed", "file3.txt"), []byte{}, 0o600)
+
+	// paths removed once matched can't be read or stat'd, which is ignored
+	m := matchFunc(func(pathname string) (Result, error) {
+		if pathname == "files/removed/" || pathname == "files/file2.txt" {
+			if err := os.RemoveAll(filepath.Join(dir, pathname)); err != nil {
+				return NotMatched, err
+			}
+		}
+		if pathname == "files/removed/" {
+			return Follow, nil
+		}
+
+		return Matched, nil
+	})
+
+	var stats GlobStats
+	matches, err := Glob(context.Background(), dir, m, WithLazyFileInfo(), WithStats(&stats))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, ok := matches[filepath.Join(dir, "files", "file1.txt")]; !ok || len(matches) != 2 {
+		t.Errorf("was expecting files and files/file1.txt, got %v", matches)
+	}
+
+	// the directory that couldn't be read isn't counted
+	if stats.Dirs != 2 || stats.Errors != 2 {
+		t.Errorf("was expecting 2 directories and 2 errors, got %+v", stats)
+	}
+
+	// errors from the matcher aren't ignored
+	_, err = Glob(context.Background(), dir, matchFunc(func(pathname string) (Result, error) {
+		return NotMatched, ErrBadPattern
+	}))
+	if err != ErrBadPattern {
+		t.Errorf("was expecting ErrBadPattern, got %v", err)
 	}
 }
 
-func TestGlob(t *testing.T) {
+func TestGlobLazyFileInfo(t *testing.T) {
 	dir, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Error(err)
@@ -401,16 +2128,15 @@ func TestGlob(t *testing.T) {
 
 	os.MkdirAll(filepath.Join(dir, "files", "dir1"), 0o777)
 	os.MkdirAll(filepath.Join(dir, "files", "dir2"), 0o777)
-	os.MkdirAll(filepath.Join(dir, "files", "dir3"), 0o111)
-	os.MkdirAll(filepath.Join(dir, "ignore", "dir4"), 0o777)
 
 	os.WriteFile(filepath.Join(dir, "files", "dir1", "file1.txt"), []byte{}, 0o600)
-	os.WriteFile(filepath.Join(dir, "files", "dir1", "file2.txt"), []byte{}, 0o600)
-	os.WriteFile(filepath.Join(dir, "files", "dir2", "file3.ignore"), []byte{}, 0o600)
-	os.WriteFile(filepath.Join(dir, "files", "dir3", "file4.txt"), []byte{}, 0o600)
-	os.WriteFile(filepath.Join(dir, "ignore", "dir4", "file5.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "dir1", "file2.bin"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "dir2", "file3.txt"), []byte{}, 0o600)
 
-	matches, err := Glob(context.Background(), dir, New("files/**/*.txt"))
+	limiter := &countingLimiter{}
+	matches, err := Glob(context.Background(), dir, New("files/**/*.txt"),
+		WithLazyFileInfo(),
+		WithRateLimiter(limiter))
 	if err != nil {
 		t.Error(err)
 	}
@@ -418,9 +2144,246 @@ func TestGlob(t *testing.T) {
 	if len(matches) != 2 {
 		t.Errorf("was expecting 2 files, got %v", len(matches))
 	}
+
+	for pathname, fi := range matches {
+		if fi == nil || fi.Name() != filepath.Base(pathname) {
+			t.Errorf("unexpected file info %v for %q", fi, pathname)
+		}
+	}
+
+	// 4 directory reads and only 2 stats for the matched files
+	if limiter.waits != 6 {
+		t.Errorf("was expecting 6 limiter waits, got %v", limiter.waits)
+	}
 }
 
-func TestGlobMultiMatcher(t *testing.T) {
+func TestGlobCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	files := filepath.Join(dir, "files")
+	os.MkdirAll(files, 0o777)
+	os.WriteFile(filepath.Join(files, "file1.txt"), []byte{}, 0o600)
+
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(files, past, past)
+	os.Chtimes(dir, past, past)
+
+	cache := NewGlobCache(0)
+	globMatches := func() map[string]os.FileInfo {
+		matches, err := Glob(context.Background(), dir, New("files/*.txt"), WithCache(cache))
+		if err != nil {
+			t.Error(err)
+		}
+		return matches
+	}
+	glob := func() int {
+		return len(globMatches())
+	}
+
+	if n := glob(); n != 1 {
+		t.Errorf("was expecting 1 file, got %v", n)
+	}
+
+	// adding a file without the directory's modification time changing
+	// returns the cached listing
+	os.WriteFile(filepath.Join(files, "file2.txt"), []byte{}, 0o600)
+	os.Chtimes(files, past, past)
+
+	if n := glob(); n != 1 {
+		t.Errorf("was expecting 1 cached file, got %v", n)
+	}
+
+	past = past.Add(time.Minute)
+	os.Chtimes(files, past, past)
+
+	if n := glob(); n != 2 {
+		t.Errorf("was expecting 2 files, got %v", n)
+	}
+
+	cache.Reset()
+	os.WriteFile(filepath.Join(files, "file3.txt"), []byte{}, 0o600)
+	os.Chtimes(files, past, past)
+
+	if n := glob(); n != 3 {
+		t.Errorf("was expecting 3 files after reset, got %v", n)
+	}
+
+	// only the listing is cached, so modified files have current FileInfos
+	os.WriteFile(filepath.Join(files, "file1.txt"), []byte("modified"), 0o600)
+	os.Chtimes(files, past, past)
+
+	if fi := globMatches()[filepath.Join(files, "file1.txt")]; fi == nil || fi.Size() != 8 {
+		t.Errorf("was expecting the current FileInfo for a modified file, got %v", fi)
+	}
+
+	// the least recently read directories are evicted
+	os.MkdirAll(filepath.Join(dir, "other"), 0o777)
+
+	small := NewGlobCache(2)
+	_, err = Glob(context.Background(), dir, New("**"), WithCache(small))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n := small.Len(); n != 2 {
+		t.Errorf("was expecting 2 cached directories, got %v", n)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	for _, opts := range [][]WatchOption{
+		{WithPollInterval(10 * time.Millisecond)},
+		{WithPollInterval(10 * time.Millisecond), WithPolling()},
+	} {
+		testWatch(t, opts)
+	}
+}
+
+func TestWatchNotifications(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("file system notifications are only supported on linux")
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "files"), 0o777)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// changes are noticed without polling
+	events, err := Watch(ctx, dir, New("files/*.txt"), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "files", "file1.txt"), []byte{}, 0o600)
+
+	select {
+	case event := <-events:
+		if event.Op != Create || event.Path != filepath.Join(dir, "files", "file1.txt") {
+			t.Errorf("was expecting create file1.txt event, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for create file1.txt event")
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func testWatch(t *testing.T, opts []WatchOption) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "files"), 0o777)
+	os.WriteFile(filepath.Join(dir, "files", "file1.txt"), []byte{}, 0o600)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 1)
+	opts = append(opts, WithWatchErrors(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}))
+
+	events, err := Watch(ctx, dir, New("files/**/*.txt"), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func(op Op, name, oldName string) {
+		select {
+		case event := <-events:
+			var oldPath string
+			if oldName != "" {
+				oldPath = filepath.Join(dir, "files", oldName)
+			}
+
+			if event.Op != op || event.Path != filepath.Join(dir, "files", name) || event.OldPath != oldPath {
+				t.Errorf("was expecting %v %v event, got %+v", op, name, event)
+			}
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %v %v event", op, name)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "files", "ignored.bin"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "file2.txt"), []byte{}, 0o600)
+	next(Create, "file2.txt", "")
+
+	os.WriteFile(filepath.Join(dir, "files", "file1.txt"), []byte("modified"), 0o600)
+	next(Modify, "file1.txt", "")
+
+	os.Rename(filepath.Join(dir, "files", "file1.txt"), filepath.Join(dir, "files", "file3.txt"))
+	next(Rename, "file3.txt", "file1.txt")
+
+	os.Remove(filepath.Join(dir, "files", "file2.txt"))
+	next(Remove, "file2.txt", "")
+
+	// paths in new directories are watched too
+	os.MkdirAll(filepath.Join(dir, "files", "sub"), 0o777)
+	os.WriteFile(filepath.Join(dir, "files", "sub", "file4.txt"), []byte{}, 0o600)
+	next(Create, filepath.Join("sub", "file4.txt"), "")
+
+	os.WriteFile(filepath.Join(dir, "files", "sub", "file4.txt"), []byte("modified"), 0o600)
+	next(Modify, filepath.Join("sub", "file4.txt"), "")
+
+	// errors are reported, and watching continues once they're resolved
+	os.RemoveAll(dir)
+
+	for reported := false; !reported; {
+		select {
+		case <-events:
+		case err := <-errs:
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("was expecting a not exist error, got %v", err)
+			}
+			reported = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for an error")
+		}
+	}
+
+	os.MkdirAll(filepath.Join(dir, "files"), 0o777)
+	os.WriteFile(filepath.Join(dir, "files", "file5.txt"), []byte{}, 0o600)
+
+	// the removed files could share an inode with the new one, so it can
+	// be reported as a rename
+	for created := false; !created; {
+		select {
+		case event := <-events:
+			created = event.Path == filepath.Join(dir, "files", "file5.txt") && event.Op != Remove
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the file created after an error")
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestGlobStats(t *testing.T) {
 	dir, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Error(err)
@@ -429,22 +2392,112 @@ func TestGlobMultiMatcher(t *testing.T) {
 	defer os.RemoveAll(dir)
 
 	os.MkdirAll(filepath.Join(dir, "files", "dir1"), 0o777)
-	os.MkdirAll(filepath.Join(dir, "files", "dir2"), 0o777)
+	os.MkdirAll(filepath.Join(dir, "ignore", "dir2"), 0o777)
 
-	os.WriteFile(filepath.Join(dir, "files", "dir1", "File1.txt"), []byte{}, 0o600)
-	os.WriteFile(filepath.Join(dir, "files", "dir1", "File2.txt"), []byte{}, 0o600)
-	os.WriteFile(filepath.Join(dir, "files", "dir2", "File3.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "dir1", "file1.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "files", "dir1", "file2.txt"), []byte{}, 0o600)
+	os.WriteFile(filepath.Join(dir, "ignore", "dir2", "file3.txt"), []byte{}, 0o600)
 
-	matches, err := Glob(context.Background(), dir, Multi(
-		New(strings.ToLower("files/DIR1/file1.txt")),
-		New(strings.ToLower("files/DIR1/file2.txt")),
-	), WithPathTransformer(strings.ToLower))
+	var stats GlobStats
+	var progress []GlobStats
+
+	_, err = Glob(context.Background(), dir, New("files/**/*.txt"),
+		WithStats(&stats),
+		WithProgress(time.Hour, func(stats GlobStats) {
+			progress = append(progress, stats)
+		}))
 	if err != nil {
 		t.Error(err)
 	}
 
-	if len(matches) != 2 {
-		t.Errorf("was expecting 2 files, got %v", len(matches))
+	// the root, files and files/dir1 are read, ignore/ is pruned
+	if stats.Dirs != 3 || stats.Pruned != 1 || stats.Matched != 2 || stats.Errors != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if len(progress) != 1 || progress[0] != stats {
+		t.Errorf("was expecting a single final progress report, got %v", progress)
+	}
+}
+
+func TestMatchAllocs(t *testing.T) {
+	m := Exclude(
+		Multi(New("**/*.go"), New("files/**/dir?/*.txt"), New("**/bar/**")),
+		New("vendor/**"),
+	)
+
+	for _, pathname := range []string{"", "main.go", "files/dir1/file1.txt", "deep/foo/bar/baz/", "vendor/x.go", "a/b/c/d/e/f/g"} {
+		allocs := testing.AllocsPerRun(100, func() {
+			m.Match(pathname)
+		})
+		if allocs != 0 {
+			t.Errorf("Match(%q) allocated %v times", pathname, allocs)
+		}
+
+		b := []byte(pathname)
+		allocs = testing.AllocsPerRun(100, func() {
+			m.(BytesMatcher).MatchBytes(b)
+		})
+		if allocs != 0 {
+			t.Errorf("MatchBytes(%q) allocated %v times", pathname, allocs)
+		}
+
+		expected, _ := m.Match(pathname)
+		result, _ := m.(BytesMatcher).MatchBytes(b)
+		if result != expected {
+			t.Errorf("MatchBytes(%q) result was %v expected %v", pathname, result, expected)
+		}
+	}
+}
+
+func TestMatchPathological(t *testing.T) {
+	pattern := strings.Repeat("**/a/", 16) + "b"
+	pathname := strings.Repeat("a/", 256) + "c"
+
+	var calls int
+	countingMatch := func(pattern, name string) (bool, error) {
+		calls++
+		return path.Match(pattern, name)
+	}
+
+	result, err := New(pattern, WithMatchFunc(countingMatch)).Match(pathname)
+	if result != Follow || err != nil {
+		t.Errorf("result was (%v, %v) expected (%v, nil)", result, err, Follow)
+	}
+
+	// each of the 257 segments is matched at most once against each of the
+	// 17 non-globstar pattern segments
+	if calls > 257*17 {
+		t.Errorf("match function called %d times, expected at most %d", calls, 257*17)
+	}
+}
+
+func BenchmarkMatchPathological(b *testing.B) {
+	b.ReportAllocs()
+
+	m := New(strings.Repeat("**/a/", 16) + "b")
+	pathname := strings.Repeat("a/", 256) + "c"
+	for n := 0; n < b.N; n++ {
+		m.Match(pathname)
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	b.ReportAllocs()
+
+	m := New("**/android/**/GeneratedPluginRegistrant.java")
+	for n := 0; n < b.N; n++ {
+		m.Match("packages/flutter_tools/lib/src/android/gradle.dart")
+	}
+}
+
+func BenchmarkMatchBytes(b *testing.B) {
+	b.ReportAllocs()
+
+	m := New("**/android/**/GeneratedPluginRegistrant.java").(BytesMatcher)
+	pathname := []byte("packages/flutter_tools/lib/src/android/gradle.dart")
+	for n := 0; n < b.N; n++ {
+		m.MatchBytes(pathname)
 	}
 }
 
@@ -527,3 +2580,37 @@ func BenchmarkWalkDoublestarMatch(b *testing.B) {
 	}
 }
 */
+
+func BenchmarkGeneralize(b *testing.B) {
+	b.ReportAllocs()
+
+	// the tests of a whole repository, such as the Go source tree, and the
+	// rest of its files
+	var paths, negatives []string
+	err := filepath.WalkDir(*globDir, func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(*globDir, pathname)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if strings.HasSuffix(rel, "_test.go") {
+			paths = append(paths, rel)
+		} else {
+			negatives = append(negatives, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		Generalize(paths, WithNegatives(negatives...))
+	}
+}
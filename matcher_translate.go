@@ -0,0 +1,824 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUntranslatable is returned when a pattern, or one of its options,
+// cannot be translated to or from another syntax.
+var ErrUntranslatable = errors.New("matcher: pattern cannot be translated")
+
+// translatable returns an error if the pattern is malformed, or its options
+// cannot be translated to the syntax named.
+func (p matcher) translatable(syntax string, caseFold, dotfiles bool) error {
+	switch {
+	case p.err != nil:
+		return p.err
+
+	case p.options.MatchFn != nil:
+		return fmt.Errorf("%w: custom match functions have no %s equivalent", ErrUntranslatable, syntax)
+
+	case p.options.Windows:
+		return fmt.Errorf("%w: Windows paths have no %s equivalent", ErrUntranslatable, syntax)
+
+	case p.options.CaseFold && !caseFold:
+		return fmt.Errorf("%w: case-insensitive matching has no %s equivalent", ErrUntranslatable, syntax)
+
+	case p.options.NoDotfiles && !dotfiles:
+		return fmt.Errorf("%w: excluding dotfiles has no %s equivalent", ErrUntranslatable, syntax)
+	}
+
+	return nil
+}
+
+// ToRegexp returns a regular expression that matches exactly the paths that
+// the pattern, with the options provided, returns Matched or MatchedAll for.
+//
+// Case-insensitive matching uses the regular expression's case folding, which
+// can differ from strings.ToLower for a few special cases. Patterns that
+// aren't valid UTF-8, or use Windows paths or a custom match function, cannot
+// be translated.
+func ToRegexp(pattern string, opts ...MatchOption) (*regexp.Regexp, error) {
+	m := New(pattern, opts...).(matcher)
+	if err := m.translatable("regular expression", true, true); err != nil {
+		return nil, err
+	}
+	if !utf8.ValidString(pattern) {
+		return nil, fmt.Errorf("%w: regular expressions cannot match invalid UTF-8", ErrUntranslatable)
+	}
+
+	// a segment that a globstar can match
+	segment := `[^/]*`
+	if m.options.NoDotfiles {
+		segment = `(?:[^./][^/]*)?`
+	}
+
+	var b strings.Builder
+	if m.options.CaseFold {
+		b.WriteString(`(?i)`)
+	}
+	b.WriteString(`^`)
+
+	last := len(m.pattern) - 1
+	for i, s := range m.pattern {
+		switch {
+		// zero or more segments, each followed by a separator
+		case s == globstar && i < last:
+			b.WriteString(`(?:` + segment + `/)*`)
+
+		// one or more segments
+		case s == globstar:
+			b.WriteString(segment + `(?:/` + segment + `)*`)
+
+		default:
+			terms := parseTerms(s)[0]
+			if m.options.NoDotfiles && !explicitlyHidden(s) {
+				b.WriteString(regexpNotHidden(terms))
+			} else {
+				b.WriteString(regexpTerms(terms))
+			}
+
+			if i < last {
+				b.WriteString(`/`)
+			}
+		}
+	}
+	b.WriteString(`$`)
+
+	return regexp.Compile(b.String())
+}
+
+// regexpTerms returns the regular expression for the terms of a segment.
+func regexpTerms(terms []term) string {
+	var b strings.Builder
+	for _, t := range terms {
+		switch t.kind {
+		case termLiteral:
+			b.WriteString(regexp.QuoteMeta(t.literal))
+		case termStar:
+			b.WriteString(`[^/]*`)
+		case termQuestion:
+			b.WriteString(`[^/]`)
+		case termClass:
+			b.WriteString(regexpClass(t.literal, "/"))
+		}
+	}
+
+	return b.String()
+}
+
+// regexpNotHidden returns the regular expression for the terms of a segment,
+// that doesn't match names beginning with a '.'.
+func regexpNotHidden(terms []term) string {
+	if len(terms) == 0 {
+		return ""
+	}
+
+	rest := regexpTerms(terms[1:])
+
+	switch terms[0].kind {
+	case termQuestion:
+		return `[^./]` + rest
+
+	case termClass:
+		return regexpClass(terms[0].literal, "./") + rest
+
+	// either the star matches nothing and the remaining terms must not
+	// match a '.', or it matches something other than a '.'
+	case termStar:
+		return `(?:` + regexpNotHidden(terms[1:]) + `|[^./][^/]*` + rest + `)`
+	}
+
+	// a literal segment beginning with '.' is explicitly hidden
+	return regexpTerms(terms)
+}
+
+// regexpClass returns the regular expression for a character class that
+// doesn't match any of the excluded characters.
+func regexpClass(class string, excluded string) string {
+	negated, ranges := parseClass(class)
+
+	var b strings.Builder
+	if negated {
+		b.WriteString(`[^`)
+		for _, r := range ranges {
+			writeRange(&b, r)
+		}
+		for _, c := range excluded {
+			writeRange(&b, [2]rune{c, c})
+		}
+		b.WriteString(`]`)
+
+		return b.String()
+	}
+
+	for _, c := range excluded {
+		var remaining [][2]rune
+		for _, r := range ranges {
+			switch {
+			case c < r[0] || c > r[1]:
+				remaining = append(remaining, r)
+			default:
+				if r[0] < c {
+					remaining = append(remaining, [2]rune{r[0], c - 1})
+				}
+				if c < r[1] {
+					remaining = append(remaining, [2]rune{c + 1, r[1]})
+				}
+			}
+		}
+		ranges = remaining
+	}
+
+	if len(ranges) == 0 {
+		return `[^\x00-\x{10FFFF}]`
+	}
+
+	b.WriteString(`[`)
+	for _, r := range ranges {
+		writeRange(&b, r)
+	}
+	b.WriteString(`]`)
+
+	return b.String()
+}
+
+func writeRange(b *strings.Builder, r [2]rune) {
+	b.WriteString(`\x{` + strconv.FormatInt(int64(r[0]), 16) + `}`)
+	if r[1] != r[0] {
+		b.WriteString(`-\x{` + strconv.FormatInt(int64(r[1]), 16) + `}`)
+	}
+}
+
+// parseClass returns whether a valid character class is negated and the
+// ranges of characters within it.
+func parseClass(class string) (negated bool, ranges [][2]rune) {
+	class = class[1 : len(class)-1]
+	if strings.HasPrefix(class, "^") {
+		negated = true
+		class = class[1:]
+	}
+
+	char := func() rune {
+		if class[0] == '\\' {
+			class = class[1:]
+		}
+		r, w := utf8.DecodeRuneInString(class)
+		class = class[w:]
+		return r
+	}
+
+	for len(class) > 0 {
+		lo := char()
+		hi := lo
+		if len(class) > 0 && class[0] == '-' {
+			class = class[1:]
+			hi = char()
+		}
+		// a reversed range matches nothing
+		if lo <= hi {
+			ranges = append(ranges, [2]rune{lo, hi})
+		}
+	}
+
+	return negated, ranges
+}
+
+// fnmatch returns a segment of a pattern in the syntax of fnmatch(3), as used
+// by find and rsync, which negates classes with a '!' rather than a '^'.
+func fnmatch(segment string) string {
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		switch segment[i] {
+		case '\\':
+			b.WriteString(segment[i:minInt(i+2, len(segment))])
+			i++
+
+		case '[':
+			n := classLen(segment[i:])
+			class := segment[i : i+n]
+			switch {
+			case strings.HasPrefix(class, "[^"):
+				class = "[!" + class[2:]
+			case strings.HasPrefix(class, "[!"):
+				class = `[\!` + class[2:]
+			}
+			b.WriteString(class)
+			i += n - 1
+
+		default:
+			b.WriteByte(segment[i])
+		}
+	}
+
+	return b.String()
+}
+
+// fromFnmatch returns a pattern in fnmatch(3) syntax in the syntax of
+// path.Match.
+func fromFnmatch(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\':
+			b.WriteString(pattern[i:minInt(i+2, len(pattern))])
+			i++
+
+		case strings.HasPrefix(pattern[i:], "[!"):
+			b.WriteString("[^")
+			i++
+
+		default:
+			b.WriteByte(pattern[i])
+		}
+	}
+
+	return b.String()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// literal returns whether a segment has no wildcards.
+func literal(segment string) bool {
+	for _, t := range parseTerms(segment)[0] {
+		if t.kind != termLiteral {
+			return false
+		}
+	}
+	return true
+}
+
+// ToFind returns the arguments of a find(1) expression, for use with
+// 'find .', that matches the same files and directories as the pattern.
+//
+// Only patterns without globstars, of the form '**/name', or with a trailing
+// globstar preceded by only literal segments, such as 'src/vendor/**', can be
+// translated, as find's wildcards match across separators. Case-insensitive
+// patterns use -ipath and -iname. The expression returned can be parsed by
+// FromFind.
+func ToFind(pattern string, opts ...MatchOption) ([]string, error) {
+	m := New(pattern, opts...).(matcher)
+	if err := m.translatable("find", true, false); err != nil {
+		return nil, err
+	}
+
+	pathTest, nameTest := "-path", "-name"
+	if m.options.CaseFold {
+		pathTest, nameTest = "-ipath", "-iname"
+	}
+
+	// depth returns a test for paths with fewer than n segments
+	depth := func(n int) []string {
+		return []string{"!", "-path", "./" + strings.Repeat("*/", n-1) + "*"}
+	}
+
+	segments := make([]string, len(m.pattern))
+	globstars := 0
+	for i, s := range m.pattern {
+		segments[i] = fnmatch(s)
+		if s == globstar {
+			globstars++
+		}
+	}
+
+	var alternatives [][]string
+	k, last := len(m.pattern), m.pattern[len(m.pattern)-1]
+
+	switch {
+	case globstars == 0:
+		// a file has exactly as many segments as the pattern
+		if last != "" {
+			test := []string{"!", "-type", "d", pathTest, "./" + strings.Join(segments, separator)}
+			alternatives = append(alternatives, append(test, depth(k+1)...))
+		}
+
+		// a directory's trailing separator can be matched by a final
+		// segment that matches an empty name
+		if matched, _ := path.Match(last, ""); matched && k > 1 {
+			test := []string{"-type", "d", pathTest, "./" + strings.Join(segments[:k-1], separator)}
+			alternatives = append(alternatives, append(test, depth(k)...))
+		}
+
+	case k == 2 && m.pattern[0] == globstar && last != globstar:
+		if last != "" {
+			alternatives = append(alternatives, []string{"!", "-type", "d", nameTest, segments[1]})
+		}
+		if matched, _ := path.Match(last, ""); matched {
+			alternatives = append(alternatives, []string{"-type", "d", "-path", "./*"})
+		}
+
+	case globstars == 1 && last == globstar:
+		for _, s := range m.pattern[:k-1] {
+			if !literal(s) {
+				return nil, fmt.Errorf("%w: find has no equivalent of a wildcard before a trailing globstar", ErrUntranslatable)
+			}
+		}
+
+		if k == 1 {
+			alternatives = append(alternatives, []string{"-path", "./*"})
+			break
+		}
+
+		dir := "./" + strings.Join(segments[:k-1], separator)
+		alternatives = append(alternatives, []string{"-type", "d", pathTest, dir}, []string{pathTest, dir + "/*"})
+
+	default:
+		return nil, fmt.Errorf("%w: find has no equivalent of globstar within a pattern", ErrUntranslatable)
+	}
+
+	switch len(alternatives) {
+	case 0:
+		// the pattern matches nothing find can return
+		return []string{"-false"}, nil
+
+	case 1:
+		return alternatives[0], nil
+	}
+
+	args := []string{"("}
+	for i, alternative := range alternatives {
+		if i > 0 {
+			args = append(args, "-o")
+		}
+		args = append(args, alternative...)
+	}
+
+	return append(args, ")"), nil
+}
+
+// FromFind returns a Matcher equivalent to the find(1) expression provided,
+// as used with 'find .'.
+//
+// The expression can combine the -name, -iname, -path, -ipath, -wholename and
+// -iwholename tests, -type d and -type f, where f is anything that isn't a
+// directory, and -false with -o, -a and ! (and their long forms), where each
+// alternative has exactly one test that isn't negated. The alternatives can
+// be grouped with '(' and ')' as a whole. As find's wildcards match across
+// separators, the patterns of -path tests can only have wildcards that are a
+// whole segment, such as './src/*/main.go', unless a negated test, such as
+// "! -path './*/*/*'", limits paths to as many segments as the pattern. As
+// such, the expressions returned by ToFind can be parsed.
+func FromFind(args []string) (Matcher, error) {
+	// the group ToFind returns around alternatives is redundant
+	if len(args) > 1 && args[0] == "(" && args[len(args)-1] == ")" {
+		args = args[1 : len(args)-1]
+	}
+
+	var (
+		alternatives []Matcher
+		include      *findTest
+		excludes     []Matcher
+		negated      bool
+
+		// the type of path an alternative is limited to, the most segments
+		// its paths can have, and whether it can't match anything
+		dirs, files bool
+		depth       int
+		never       bool
+	)
+
+	end := func() error {
+		defer func() {
+			include, excludes, dirs, files, depth, never = nil, nil, false, false, 0, false
+		}()
+
+		if include == nil {
+			if never {
+				return nil
+			}
+			return fmt.Errorf("%w: each alternative must have a test that isn't negated", ErrUntranslatable)
+		}
+
+		m, err := include.matcher(depth)
+		if err != nil || never || (dirs && files) {
+			return err
+		}
+
+		if dirs || files {
+			m = typeMatcher{Matcher: m, dirs: dirs}
+		}
+		if len(excludes) > 0 {
+			m = Exclude(m, Multi(excludes...))
+		}
+		alternatives = append(alternatives, m)
+
+		return nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "!", "-not":
+			negated = !negated
+
+		case "-a", "-and":
+
+		case "-o", "-or":
+			if err := end(); err != nil {
+				return nil, err
+			}
+
+		case "-false":
+			never = never || !negated
+			negated = false
+
+		case "-type":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("matcher: missing argument to %s", arg)
+			}
+			i++
+
+			if args[i] != "d" && args[i] != "f" {
+				return nil, fmt.Errorf("%w: find's -type %s", ErrUntranslatable, args[i])
+			}
+			if (args[i] == "d") != negated {
+				dirs = true
+			} else {
+				files = true
+			}
+			negated = false
+
+		case "-name", "-iname", "-path", "-ipath", "-wholename", "-iwholename":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("matcher: missing argument to %s", arg)
+			}
+			i++
+
+			test := &findTest{
+				pattern: args[i],
+				name:    strings.HasSuffix(arg, "name") && !strings.HasSuffix(arg, "wholename"),
+			}
+			if strings.HasPrefix(arg, "-i") {
+				test.opts = append(test.opts, WithCaseFold())
+			}
+
+			switch {
+			case negated:
+				m, err := test.matcher(0)
+				if err != nil {
+					return nil, err
+				}
+				excludes = append(excludes, m)
+
+				if n := strings.Count(test.pattern, "*") - 1; !test.name && findDepth.MatchString(test.pattern) && (depth == 0 || n < depth) {
+					depth = n
+				}
+
+			case include != nil:
+				return nil, fmt.Errorf("%w: find has more than one test in an alternative", ErrUntranslatable)
+
+			default:
+				include = test
+			}
+			negated = false
+
+		default:
+			return nil, fmt.Errorf("%w: find's %s", ErrUntranslatable, arg)
+		}
+	}
+
+	if err := end(); err != nil {
+		return nil, err
+	}
+
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+
+	return Multi(alternatives...), nil
+}
+
+// findDepth matches the pattern of a -path test for paths with at least as
+// many segments as it has wildcards.
+var findDepth = regexp.MustCompile(`^\./(\*/)*\*$`)
+
+// findTest is a -name or -path test of a find(1) expression.
+type findTest struct {
+	pattern string
+	name    bool
+	opts    []MatchOption
+}
+
+// matcher returns a Matcher for the test, for paths with at most depth
+// segments, if depth isn't 0.
+func (t *findTest) matcher(depth int) (Matcher, error) {
+	switch {
+	case t.name:
+		return fromFindName(t.pattern, t.opts)
+
+	// wildcards can't match across separators when there are as many
+	// segments in the pattern as in the paths
+	case depth > 0 && strings.Count(t.pattern, separator) == depth:
+		return fromFindBoundedPath(t.pattern, t.opts)
+	}
+
+	return fromFindPath(t.pattern, t.opts)
+}
+
+// typeMatcher only matches directories, or only paths that aren't
+// directories, like find's -type test.
+type typeMatcher struct {
+	Matcher
+	dirs bool
+}
+
+func (p typeMatcher) Match(pathname string) (Result, error) {
+	result, err := p.Matcher.Match(pathname)
+	dir := strings.HasSuffix(pathname, separator)
+
+	switch {
+	case err != nil:
+		return NotMatched, err
+
+	case p.dirs && !dir:
+		return NotMatched, nil
+
+	// paths below can be excluded for not being directories
+	case p.dirs && result == MatchedAll:
+		return Matched, nil
+
+	// paths below can be matched, even if the directory isn't
+	case !p.dirs && dir && result != NotMatched:
+		return Follow, nil
+	}
+
+	return result, nil
+}
+
+// fromFindName returns a Matcher for files and directories with a base name
+// matching the pattern.
+func fromFindName(pattern string, opts []MatchOption) (Matcher, error) {
+	if strings.Contains(pattern, separator) {
+		return nil, fmt.Errorf("%w: a name containing a separator", ErrUntranslatable)
+	}
+
+	pattern = globstar + separator + fromFnmatch(pattern)
+
+	return validate(Multi(New(pattern, opts...), New(pattern+separator, opts...)))
+}
+
+// fromFindPath returns a Matcher for files and directories with a path
+// matching the pattern.
+func fromFindPath(pattern string, opts []MatchOption) (Matcher, error) {
+	if !strings.HasPrefix(pattern, "./") {
+		return nil, fmt.Errorf("%w: a path not beginning with './'", ErrUntranslatable)
+	}
+
+	segments := strings.Split(fromFnmatch(pattern[2:]), separator)
+	for i, s := range segments {
+		switch {
+		case s == "*" && i == len(segments)-1:
+
+		// a wildcard crossing separators matches one or more segments
+		case s == "*":
+			segments[i] = "*/**"
+
+		case !literal(s):
+			return nil, fmt.Errorf("%w: find's wildcards in a path match across separators", ErrUntranslatable)
+		}
+	}
+
+	// everything below a directory, but not the directory itself
+	if segments[len(segments)-1] == "*" {
+		dir := strings.Join(segments[:len(segments)-1], separator)
+		if dir != "" {
+			dir += separator
+		}
+
+		return validate(Exclude(New(dir+globstar, opts...), New(dir, opts...)))
+	}
+
+	pattern = strings.Join(segments, separator)
+
+	return validate(Multi(New(pattern, opts...), New(pattern+separator, opts...)))
+}
+
+// fromFindBoundedPath returns a Matcher for files and directories with a path
+// matching the pattern, when the paths can't have more segments than the
+// pattern, so its wildcards can't match across separators.
+func fromFindBoundedPath(pattern string, opts []MatchOption) (Matcher, error) {
+	if !strings.HasPrefix(pattern, "./") {
+		return nil, fmt.Errorf("%w: a path not beginning with './'", ErrUntranslatable)
+	}
+
+	// a final segment matching an empty name, such as '*', would match a
+	// directory's trailing separator, whereas find's names are never empty
+	segments := strings.Split(fromFnmatch(pattern[2:]), separator)
+	if last := segments[len(segments)-1]; last != "" {
+		if matched, _ := path.Match(last, ""); matched {
+			segments[len(segments)-1] = "?" + last
+		}
+	}
+
+	pattern = strings.Join(segments, separator)
+
+	return validate(Multi(New(pattern, opts...), New(pattern+separator, opts...)))
+}
+
+// validate returns an error if any of the patterns of a matcher are
+// malformed.
+func validate(m Matcher) (Matcher, error) {
+	_, err := m.Match("")
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// ToRsync returns rsync(1) filter rules that together select the same files
+// and directories as the pattern: include rules for the pattern, followed by
+// '+ */', so that rsync descends into every directory, and '- *', excluding
+// everything else. As every directory is included, use rsync's
+// --prune-empty-dirs (-m) to leave out those containing nothing matched.
+//
+// Unlike this package's patterns, rsync's patterns without a trailing '/'
+// also match directories of the same name. Case-insensitive patterns, and
+// those excluding dotfiles, cannot be translated.
+func ToRsync(pattern string, opts ...MatchOption) ([]string, error) {
+	m := New(pattern, opts...).(matcher)
+	if err := m.translatable("rsync", false, false); err != nil {
+		return nil, err
+	}
+
+	// consecutive globstars are equivalent to one
+	var segments []string
+	for _, s := range m.pattern {
+		if s == globstar && len(segments) > 0 && segments[len(segments)-1] == globstar {
+			continue
+		}
+		segments = append(segments, s)
+	}
+
+	// rsync's '**' between separators matches one or more segments, so each
+	// globstar within the pattern is translated both with and without it
+	variants := [][]string{nil}
+	for i, s := range segments {
+		switch {
+		case s == globstar && i == len(segments)-1:
+			for j := range variants {
+				variants[j] = append(variants[j], "***")
+			}
+
+		case s == globstar:
+			n := len(variants)
+			for j := 0; j < n; j++ {
+				variants = append(variants, append(append([]string(nil), variants[j]...), globstar))
+			}
+
+		default:
+			for j := range variants {
+				variants[j] = append(variants[j], fnmatch(s))
+			}
+		}
+	}
+
+	var rules []string
+	seen := make(map[string]bool)
+	add := func(pattern string) {
+		if !seen[pattern] {
+			seen[pattern] = true
+			rules = append(rules, "+ /"+pattern)
+		}
+	}
+
+	last := segments[len(segments)-1]
+	for _, variant := range variants {
+		add(strings.Join(variant, separator))
+
+		// a directory's trailing separator can be matched by a final segment
+		// that matches an empty name
+		if matched, _ := path.Match(last, ""); matched && last != "" && last != globstar && len(variant) > 1 {
+			add(strings.Join(variant[:len(variant)-1], separator) + separator)
+		}
+	}
+
+	return append(rules, "+ */", "- *"), nil
+}
+
+// FromRsync returns a Matcher equivalent to an rsync(1) filter pattern, with
+// or without its '+ ' rule prefix.
+//
+// Exclude rules, with a '- ' prefix, patterns with '**' within a segment,
+// which matches across separators, or '***' other than at the end of a
+// pattern, cannot be translated.
+func FromRsync(pattern string) (Matcher, error) {
+	if strings.HasPrefix(pattern, "- ") {
+		return nil, fmt.Errorf("%w: rsync exclude rules select the paths not matched", ErrUntranslatable)
+	}
+	pattern = strings.TrimPrefix(pattern, "+ ")
+
+	var prefix string
+	if strings.HasPrefix(pattern, separator) {
+		pattern = pattern[1:]
+	} else {
+		// unanchored patterns match the end of a path
+		prefix = globstar + separator
+	}
+
+	dirOnly := strings.HasSuffix(pattern, separator)
+	pattern = strings.TrimSuffix(pattern, separator)
+
+	contents := strings.HasSuffix(pattern, "/***") || pattern == "***"
+	pattern = strings.TrimSuffix(strings.TrimSuffix(pattern, "***"), separator)
+
+	var segments []string
+	if pattern != "" {
+		segments = strings.Split(fromFnmatch(pattern), separator)
+	}
+
+	below := false
+	for i, s := range segments {
+		switch {
+		case s == globstar && i == len(segments)-1:
+			below = true
+			segments = segments[:i]
+
+		// between separators, '**' matches one or more segments
+		case s == globstar:
+			segments[i] = "*/**"
+
+		case strings.Contains(s, globstar):
+			return nil, fmt.Errorf("%w: rsync's '**' within a segment matches across separators", ErrUntranslatable)
+		}
+	}
+	if strings.Contains(pattern, "***") {
+		return nil, fmt.Errorf("%w: rsync's '***' other than at the end of a pattern", ErrUntranslatable)
+	}
+
+	base := prefix + strings.Join(segments, separator)
+	if len(segments) == 0 {
+		base = strings.TrimSuffix(prefix, separator)
+	}
+
+	switch {
+	case contents && dirOnly:
+		return nil, fmt.Errorf("%w: rsync's '***' followed by a separator", ErrUntranslatable)
+
+	case contents || below:
+		dir := base
+		if dir != "" {
+			dir += separator
+		}
+
+		if below {
+			return validate(Exclude(New(dir+globstar), New(dir)))
+		}
+		return validate(New(dir + globstar))
+
+	case dirOnly:
+		return validate(New(base + separator))
+	}
+
+	return validate(Multi(New(base), New(base+separator)))
+}
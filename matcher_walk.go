@@ -0,0 +1,239 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// walker is a concurrent directory walker, modelled on
+// github.com/saracen/walker, but with the ability to limit the number of
+// goroutines used, the rate of I/O and the number of directories being read
+// at once.
+type walker struct {
+	counter  int32
+	limit    int32
+	ctx      context.Context
+	wg       *errgroup.Group
+	fn       walkFunc
+	reads    chan struct{}
+	options  *globOptions
+	counters *globCounters
+}
+
+// walkFunc is called for each file and directory walked, with the walkState
+// returned for its parent directory. The walkState returned for a directory
+// is passed to each of its entries.
+type walkFunc func(pathname string, entry os.DirEntry, parent walkState) (walkState, error)
+
+// walkState is carried from a directory to its entries, so that nothing needs
+// to be held for the directories already walked.
+type walkState struct {
+	// state is the State of the directory, when stepping
+	state State
+
+	// all is whether the directory was MatchedAll
+	all bool
+}
+
+func walk(ctx context.Context, root string, options *globOptions, counters *globCounters, walkFn walkFunc) error {
+	wg, ctx := errgroup.WithContext(ctx)
+
+	fi, err := os.Lstat(root)
+	if err != nil {
+		return err
+	}
+	ws, err := walkFn(root, fs.FileInfoToDirEntry(fi), walkState{})
+	if err == filepath.SkipDir {
+		return nil
+	}
+	if err != nil || !fi.IsDir() {
+		return err
+	}
+
+	w := walker{
+		counter:  1,
+		limit:    int32(options.Workers),
+		ctx:      ctx,
+		wg:       wg,
+		fn:       walkFn,
+		options:  options,
+		counters: counters,
+	}
+	if w.limit <= 0 {
+		w.limit = int32(runtime.NumCPU())
+		if w.limit < 4 {
+			w.limit = 4
+		}
+	}
+	if options.MaxConcurrentReads > 0 {
+		w.reads = make(chan struct{}, options.MaxConcurrentReads)
+	}
+
+	w.wg.Go(func() error {
+		return w.gowalk(root, ws)
+	})
+
+	return w.wg.Wait()
+}
+
+func (w *walker) walk(dirname string, entry os.DirEntry, parent walkState) error {
+	pathname := dirname + string(filepath.Separator) + entry.Name()
+
+	ws, err := w.fn(pathname, entry, parent)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// don't follow symbolic links
+	if entry.Type()&os.ModeSymlink != 0 || !entry.IsDir() {
+		return nil
+	}
+
+	if err = w.ctx.Err(); err != nil {
+		return err
+	}
+
+	current := atomic.LoadInt32(&w.counter)
+
+	// if we haven't reached our goroutine limit, spawn a new one
+	if current < w.limit {
+		if atomic.CompareAndSwapInt32(&w.counter, current, current+1) {
+			w.wg.Go(func() error {
+				return w.gowalk(pathname, ws)
+			})
+			return nil
+		}
+	}
+
+	// if we've reached our limit, continue with this goroutine
+	return w.readdir(pathname, ws)
+}
+
+func (w *walker) gowalk(pathname string, ws walkState) error {
+	err := w.readdir(pathname, ws)
+	atomic.AddInt32(&w.counter, -1)
+
+	return err
+}
+
+// readdir reads a directory and walks each of its entries. Errors from
+// reading the directory or its entries are ignored, but errors returned by
+// the walk function or context are not.
+func (w *walker) readdir(dirname string, ws walkState) error {
+	if err := w.wait(); err != nil {
+		return err
+	}
+
+	list := w.list
+	if w.options.Cache != nil {
+		list = func(dirname string) ([]os.DirEntry, error) {
+			return w.options.Cache.list(w, dirname)
+		}
+	}
+
+	entries, err := list(dirname)
+	if err != nil {
+		if ctxErr := w.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		atomic.AddInt64(&w.counters.errors, 1)
+		return nil
+	}
+
+	atomic.AddInt64(&w.counters.dirs, 1)
+	if w.options.ReadDirFn != nil {
+		w.options.ReadDirFn(dirname)
+	}
+
+	for _, entry := range entries {
+		entry = &walkerEntry{DirEntry: entry, w: w}
+
+		if !w.options.LazyFileInfo {
+			fi, err := entry.Info()
+			if ignorable(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			entry = fs.FileInfoToDirEntry(fi)
+		}
+
+		if err = w.walk(dirname, entry, ws); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// list returns the entries of a directory, holding one of the concurrent read
+// slots, if limited, for the duration of the read.
+func (w *walker) list(dirname string) ([]os.DirEntry, error) {
+	if w.reads != nil {
+		select {
+		case w.reads <- struct{}{}:
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		}
+		defer func() { <-w.reads }()
+	}
+
+	f, err := os.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.ReadDir(-1)
+}
+
+// walkerEntry wraps an os.DirEntry so that calls to Info are rate limited
+// and errors counted.
+type walkerEntry struct {
+	os.DirEntry
+	w *walker
+}
+
+// Info returns the FileInfo of the entry. An error is returned if the file
+// has been removed since the directory was read, or we don't have permission
+// to stat it.
+func (e *walkerEntry) Info() (os.FileInfo, error) {
+	if err := e.w.wait(); err != nil {
+		return nil, err
+	}
+
+	fi, err := e.DirEntry.Info()
+	if err != nil {
+		atomic.AddInt64(&e.w.counters.errors, 1)
+	}
+
+	return fi, err
+}
+
+// ignorable returns true if the error is a permission or I/O error for a
+// path, rather than from the rate limiter or context.
+func ignorable(err error) bool {
+	var pathErr *fs.PathError
+
+	return errors.As(err, &pathErr)
+}
+
+// wait blocks until the rate limiter, if any, permits an I/O operation.
+func (w *walker) wait() error {
+	if w.options.Limiter == nil {
+		return nil
+	}
+
+	return w.options.Limiter.Wait(w.ctx)
+}
@@ -0,0 +1,246 @@
+package matcher
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Op describes a change to a watched path.
+type Op int
+
+const (
+	Create Op = iota + 1
+	Modify
+	Remove
+	Rename
+)
+
+func (op Op) String() string {
+	switch op {
+	case Create:
+		return "create"
+	case Modify:
+		return "modify"
+	case Remove:
+		return "remove"
+	case Rename:
+		return "rename"
+	}
+	return "unknown"
+}
+
+// Event is a change to a path matched by a watch.
+type Event struct {
+	Op Op
+
+	// Path is the pathname of the file or directory changed, in the same
+	// form as returned by Glob.
+	Path string
+
+	// OldPath is the previous pathname of a renamed file or directory.
+	OldPath string
+
+	// Info is the os.FileInfo of the file or directory, or nil if it was
+	// removed.
+	Info os.FileInfo
+}
+
+// Watch watches the directory provided for changes to files and directories
+// matched by the Matcher, sending events to the channel returned until the
+// context is cancelled.
+//
+// Changes are found by globbing the directory, so like Glob, only
+// directories the Matcher returns Matched or Follow for are read. Where file
+// system notifications are available (inotify on Linux), each directory read
+// is watched and the directory is globbed again when any of them change.
+// Otherwise, or with WithPolling, the directory is globbed every poll
+// interval. A file removed and another created with the same identity
+// (device and inode on Unix) between globs is reported as a rename.
+//
+// An error is returned if the directory cannot be globbed initially. Later
+// errors are reported to the function provided with WithWatchErrors, and
+// the directory is polled until it can be globbed again.
+func Watch(ctx context.Context, dir string, matcher Matcher, opts ...WatchOption) (<-chan Event, error) {
+	options := watchOptions{
+		PollInterval: time.Second,
+	}
+	for _, o := range opts {
+		err := o(&options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := func(err error) {
+		if options.ErrorFn != nil {
+			options.ErrorFn(err)
+		}
+	}
+
+	// glob returns the paths matched, and the directories read
+	glob := func() (map[string]os.FileInfo, map[string]bool, error) {
+		var mu sync.Mutex
+		dirs := make(map[string]bool)
+
+		matches, err := Glob(ctx, dir, matcher, WithLazyFileInfo(), withReadDirs(func(dirname string) {
+			mu.Lock()
+			dirs[dirname] = true
+			mu.Unlock()
+		}))
+
+		return matches, dirs, err
+	}
+
+	previous, dirs, err := glob()
+	if err != nil {
+		return nil, err
+	}
+
+	// fall back to polling where notifications are unavailable
+	var notify notifier
+	if !options.Polling {
+		notify, _ = newNotifier()
+	}
+
+	// watch sets the directories watched, returning whether any were added,
+	// and falls back to polling if they can't be, such as when the limit on
+	// the number of watches is reached
+	watch := func(dirs map[string]bool) bool {
+		if notify == nil {
+			return false
+		}
+
+		added, err := notify.watch(dirs)
+		if err != nil {
+			notify.close()
+			notify = nil
+			report(err)
+		}
+
+		return added
+	}
+
+	// paths created in a directory before it's watched are found by globbing
+	// again
+	rescan := watch(dirs)
+
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+		defer func() {
+			if notify != nil {
+				notify.close()
+			}
+		}()
+
+		ticker := time.NewTicker(options.PollInterval)
+		defer ticker.Stop()
+
+		failed := false
+		for {
+			var changes <-chan struct{}
+			if notify != nil {
+				changes = notify.changes()
+			}
+
+			if !rescan {
+				select {
+				case <-ctx.Done():
+					return
+				case <-changes:
+				case <-ticker.C:
+					// with notifications, only poll until globbing succeeds
+					if notify != nil && !failed {
+						continue
+					}
+				}
+			}
+
+			current, dirs, err := glob()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				failed, rescan = true, false
+				report(err)
+				continue
+			}
+			failed = false
+			rescan = watch(dirs)
+
+			for _, event := range diff(previous, current) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			previous = current
+		}
+	}()
+
+	return events, nil
+}
+
+// notifier reports changes to the directories it watches.
+type notifier interface {
+	// watch sets the directories watched, returning whether any were added.
+	watch(dirs map[string]bool) (bool, error)
+
+	// changes returns a channel that receives a value when any watched
+	// directory, or its entries, change.
+	changes() <-chan struct{}
+
+	close() error
+}
+
+// diff returns the events that describe the changes between two globs,
+// sorted by path.
+func diff(previous, current map[string]os.FileInfo) []Event {
+	var events, removed []Event
+
+	for pathname, fi := range current {
+		old, ok := previous[pathname]
+		switch {
+		case !ok:
+			events = append(events, Event{Op: Create, Path: pathname, Info: fi})
+
+		case !old.ModTime().Equal(fi.ModTime()) || old.Size() != fi.Size() || old.Mode() != fi.Mode():
+			events = append(events, Event{Op: Modify, Path: pathname, Info: fi})
+		}
+	}
+
+	for pathname, fi := range previous {
+		if _, ok := current[pathname]; !ok {
+			removed = append(removed, Event{Op: Remove, Path: pathname, Info: fi})
+		}
+	}
+
+	// pair removed files with created files that are the same file
+	for _, remove := range removed {
+		renamed := false
+		for i, event := range events {
+			if event.Op == Create && os.SameFile(remove.Info, event.Info) {
+				events[i] = Event{Op: Rename, Path: event.Path, OldPath: remove.Path, Info: event.Info}
+				renamed = true
+				break
+			}
+		}
+
+		if !renamed {
+			events = append(events, Event{Op: Remove, Path: remove.Path})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+
+	return events
+}
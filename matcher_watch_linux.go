@@ -0,0 +1,134 @@
+package matcher
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF |
+	syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW
+
+// inotify is a notifier using Linux's inotify API, with a watch on each
+// directory.
+type inotify struct {
+	fd      int
+	f       *os.File
+	mu      sync.Mutex
+	watches map[string]int
+	paths   map[int]string
+	changed chan struct{}
+}
+
+func newNotifier() (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	n := &inotify{
+		fd: fd,
+
+		// a non-blocking file uses the runtime's poller, so that closing it
+		// interrupts a read in progress
+		f:       os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[string]int),
+		paths:   make(map[int]string),
+		changed: make(chan struct{}, 1),
+	}
+	go n.read()
+
+	return n, nil
+}
+
+func (n *inotify) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		size, err := n.f.Read(buf)
+		if err != nil {
+			return
+		}
+
+		changed := false
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= size; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			// a watch is removed along with its directory, and removing it
+			// isn't a change
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				n.forget(int(event.Wd))
+				continue
+			}
+			changed = true
+		}
+
+		if changed {
+			select {
+			case n.changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (n *inotify) watch(dirs map[string]bool) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for dirname, wd := range n.watches {
+		if !dirs[dirname] {
+			// the watch is already gone if the directory was removed
+			syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.watches, dirname)
+			delete(n.paths, wd)
+		}
+	}
+
+	added := false
+	for dirname := range dirs {
+		if _, ok := n.watches[dirname]; ok {
+			continue
+		}
+
+		wd, err := syscall.InotifyAddWatch(n.fd, dirname, inotifyMask)
+		switch {
+		// a directory removed since being read is noticed by its parent's
+		// watch
+		case errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENOTDIR):
+			continue
+
+		case err != nil:
+			return added, os.NewSyscallError("inotify_add_watch", err)
+		}
+
+		n.watches[dirname] = wd
+		n.paths[wd] = dirname
+		added = true
+	}
+
+	return added, nil
+}
+
+// forget removes a watch that no longer exists.
+func (n *inotify) forget(wd int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if dirname, ok := n.paths[wd]; ok {
+		delete(n.watches, dirname)
+		delete(n.paths, wd)
+	}
+}
+
+func (n *inotify) changes() <-chan struct{} {
+	return n.changed
+}
+
+func (n *inotify) close() error {
+	return n.f.Close()
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package matcher
+
+import "errors"
+
+func newNotifier() (notifier, error) {
+	return nil, errors.New("matcher: file system notifications are unsupported on this platform")
+}